@@ -1,15 +1,31 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/augustine0890/dapp-bot/internal/database"
 	"github.com/augustine0890/dapp-bot/pkg/config"
 	"github.com/augustine0890/dapp-bot/pkg/discord"
 	"github.com/augustine0890/dapp-bot/pkg/logging"
 )
 
 func main() {
+	if err := run(); err != nil {
+		logging.Error("Bot stopped with an error", err)
+		logging.Flush()
+		os.Exit(1)
+	}
+}
+
+// run runs the bot, or the subcommand given on the command line, until it is stopped
+func run() error {
 	// Flag will be stored in the stage variable at runtime
 	stage := flag.String("stage", "prod", "The enviroment running")
 	flag.Parse()
@@ -17,19 +33,115 @@ func main() {
 	// Load the application configuration
 	cfg, err := config.LoadConfig(*stage)
 	if err != nil {
-		logging.Fatal("Failed to read config file", err)
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
 	log.Printf("Config loaded and running with %s stage.", *stage)
 
+	// Run a subcommand instead of the bot when one is given
+	switch flag.Arg(0) {
+	case "":
+	case "reconcile":
+		err := runReconcile(cfg, flag.Args()[1:])
+		if err != nil {
+			return fmt.Errorf("failed to reconcile points: %w", err)
+		}
+		return nil
+	case "migrate":
+		err := runMigrate(cfg, flag.Args()[1:])
+		if err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown subcommand %q", flag.Arg(0))
+	}
+
 	// Create a new Discord bot instance
 	dc, err := discord.NewDiscord(cfg)
 	if err != nil {
-		logging.Fatal("Failed to create Discord bot instance:", err)
+		return fmt.Errorf("failed to create Discord bot instance: %w", err)
+	}
+
+	// Run the bot until CTRL-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runErr := dc.Run(ctx)
+	stop()
+
+	// Give the commands and events in flight time to finish, a second signal is not caught anymore
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err = dc.Shutdown(shutdownCtx)
+	if runErr != nil {
+		return runErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to shut down cleanly: %w", err)
+	}
+	return nil
+}
+
+// runReconcile compares the points of users with their activities and prints the differences.
+// Usage: reconcile [-repair]
+func runReconcile(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "Rebuild the points of users from their activities")
+	if err := flags.Parse(args); err != nil {
+		return err
 	}
 
-	// Connect to bot to the server
-	err = dc.Connect()
+	mongoClient, err := database.GetMongoClient(cfg.MongoURI, cfg.MongoDBName, 10*time.Second)
 	if err != nil {
-		logging.Fatal("Failed to connect to Discord server:", err)
+		return err
+	}
+	defer mongoClient.Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report, err := database.Reconcile(ctx, database.NewMongoStore(mongoClient, cfg), *repair)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range report.Discrepancies {
+		fmt.Println(d)
+	}
+	fmt.Printf("Checked %d users, found %d discrepancies, repaired %d.\n", report.Checked, len(report.Discrepancies), report.Repaired)
+	return nil
+}
+
+// runMigrate applies the pending database migrations, or lists them with -dry-run.
+// Usage: migrate [-dry-run]
+func runMigrate(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "List the pending migrations without applying them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	mongoClient, err := database.GetMongoClient(cfg.MongoURI, cfg.MongoDBName, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer mongoClient.Disconnect(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	migrations, err := database.NewMongoStore(mongoClient, cfg).Migrate(ctx, *dryRun)
+	for _, migration := range migrations {
+		if *dryRun {
+			fmt.Printf("Pending %d: %s\n", migration.Version, migration.Description)
+		} else {
+			fmt.Printf("Applied %d: %s\n", migration.Version, migration.Description)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		fmt.Println("The database is up to date.")
 	}
+	return nil
 }
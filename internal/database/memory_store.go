@@ -0,0 +1,723 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore represents a Store kept in memory, for running commands without MongoDB
+type MemoryStore struct {
+	mu         sync.Mutex
+	users      map[string]*User
+	activities []*Activity
+	keys       map[string]bool // idempotency keys of the activities
+	audit      []AuditEntry
+	blocked    []BlockedReaction
+	items      map[string]*ShopItem
+	purchases  []*Purchase
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new empty MemoryStore instance
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users: make(map[string]*User),
+		keys:  make(map[string]bool),
+		items: make(map[string]*ShopItem),
+	}
+}
+
+// GetUser returns the user with the given ID, or ErrNotFound
+func (ms *MemoryStore) GetUser(ctx context.Context, userID string) (*User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, ok := ms.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// CreateUser inserts a new user
+func (ms *MemoryStore) CreateUser(ctx context.Context, user *User) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.users[user.ID]; ok {
+		return ErrAlreadyExists
+	}
+	copied := *user
+	ms.users[user.ID] = &copied
+	return nil
+}
+
+// DeleteUser deletes the user with the given ID
+func (ms *MemoryStore) DeleteUser(ctx context.Context, userID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.users, userID)
+	return nil
+}
+
+// CheckIn records the daily attendance of the user, or returns ErrAlreadyCheckedIn
+func (ms *MemoryStore) CheckIn(ctx context.Context, checkIn *CheckIn) (*User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if user, ok := ms.users[checkIn.UserID]; ok && !user.LastAttendance.Before(checkIn.Since) {
+		return nil, ErrAlreadyCheckedIn
+	}
+
+	user := ms.getOrCreate(checkIn.UserID, checkIn.UserName, checkIn.JoinedDate, checkIn.At)
+	user.UserName = checkIn.UserName
+	user.StreakFreezes += checkIn.StreakFreezes
+	user.LastAttendance = checkIn.At
+	user.CurrentStreak = checkIn.CurrentStreak
+	user.LongestStreak = checkIn.LongestStreak
+	user.UpdatedAt = checkIn.At
+
+	copied := *user
+	return &copied, nil
+}
+
+// ListUsers returns every user, including the users who left
+func (ms *MemoryStore) ListUsers(ctx context.Context) ([]User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	users := make([]User, 0, len(ms.users))
+	for _, user := range ms.users {
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+// UpdateMember updates the name and the date the user joined the guild, or returns ErrNotFound
+func (ms *MemoryStore) UpdateMember(ctx context.Context, userID, userName string, joinedDate time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, ok := ms.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.UserName = userName
+	user.JoinedDate = joinedDate
+	return nil
+}
+
+// Leaderboard returns a page of the active users ranked by the points they earned since the given time
+func (ms *MemoryStore) Leaderboard(ctx context.Context, since time.Time, skip, limit int) ([]LeaderboardEntry, int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entries := ms.leaderboard(since)
+	total := len(entries)
+	if skip >= total {
+		return nil, total, nil
+	}
+	entries = entries[skip:]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, total, nil
+}
+
+// LeaderboardPosition returns the rank and the entry of the user on the leaderboard
+func (ms *MemoryStore) LeaderboardPosition(ctx context.Context, since time.Time, userID string) (int, *LeaderboardEntry, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for i, entry := range ms.leaderboard(since) {
+		if entry.UserID == userID {
+			return i + 1, &entry, nil
+		}
+	}
+	return 0, nil, nil
+}
+
+// MarkLeft marks the user as having left the guild at the given time, or returns ErrNotFound
+func (ms *MemoryStore) MarkLeft(ctx context.Context, userID string, at time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, ok := ms.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.LeftAt = at
+	user.UpdatedAt = at
+	return nil
+}
+
+// RestoreUser marks the user as a member of the guild again, or returns ErrNotFound
+func (ms *MemoryStore) RestoreUser(ctx context.Context, userID, userName string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, ok := ms.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.UserName = userName
+	user.LeftAt = time.Time{}
+	user.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// LeftUsers returns the users who left the guild before the given time
+func (ms *MemoryStore) LeftUsers(ctx context.Context, before time.Time) ([]User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var users []User
+	for _, user := range ms.users {
+		if !user.Active() && user.LeftAt.Before(before) {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+// TopUsers returns the active users with the most points, at most limit or all when 0
+func (ms *MemoryStore) TopUsers(ctx context.Context, limit int) ([]User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	users := ms.ranked()
+	if limit > 0 && len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// UserRank returns the ranking of the user by points and the number of ranked users
+func (ms *MemoryStore) UserRank(ctx context.Context, userID string) (int, int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	users := ms.ranked()
+	for i, user := range users {
+		if user.ID == userID {
+			return i + 1, len(users), nil
+		}
+	}
+	return 0, len(users), nil
+}
+
+// ApplyActivity records the activity and adds its reward to the points of the user
+func (ms *MemoryStore) ApplyActivity(ctx context.Context, activity *Activity) (*User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if activity.Key != "" {
+		if ms.keys[activity.Key] {
+			return nil, ErrDuplicateActivity
+		}
+		ms.keys[activity.Key] = true
+	}
+	copied := *activity
+	ms.activities = append(ms.activities, &copied)
+
+	return ms.addPoints(activity.User, activity.UserName, activity.Reward), nil
+}
+
+// ApplyDebit records the activity and takes its cost from the points of the user, when they have enough
+func (ms *MemoryStore) ApplyDebit(ctx context.Context, activity *Activity) (*User, error) {
+	cost := -activity.Reward
+	if cost <= 0 {
+		return nil, fmt.Errorf("debit activity must have a negative reward, got %d", activity.Reward)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if activity.Key != "" && ms.keys[activity.Key] {
+		return nil, ErrDuplicateActivity
+	}
+	user, ok := ms.users[activity.User]
+	if !ok || user.Points < cost {
+		return nil, ErrInsufficientPoints
+	}
+	if activity.Key != "" {
+		ms.keys[activity.Key] = true
+	}
+	copied := *activity
+	ms.activities = append(ms.activities, &copied)
+
+	return ms.addPoints(activity.User, activity.UserName, activity.Reward), nil
+}
+
+// ApplyAdjust records the activity and adds its reward to the user when they still have current points
+func (ms *MemoryStore) ApplyAdjust(ctx context.Context, activity *Activity, current int) (*User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if activity.Key != "" && ms.keys[activity.Key] {
+		return nil, ErrDuplicateActivity
+	}
+	user, ok := ms.users[activity.User]
+	if (ok && user.Points != current) || (!ok && current != 0) {
+		return nil, ErrPointsChanged
+	}
+	if activity.Key != "" {
+		ms.keys[activity.Key] = true
+	}
+	copied := *activity
+	ms.activities = append(ms.activities, &copied)
+
+	return ms.addPoints(activity.User, activity.UserName, activity.Reward), nil
+}
+
+// RevertActivity deletes one activity matching the filter and takes its reward back from the user
+func (ms *MemoryStore) RevertActivity(ctx context.Context, filter ActivityFilter) (*Activity, *User, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for i, activity := range ms.activities {
+		if filter.matches(activity) {
+			if user, ok := ms.users[activity.User]; activity.Reward > 0 && (!ok || user.Points < activity.Reward) {
+				return nil, nil, ErrInsufficientPoints
+			}
+			ms.activities = append(ms.activities[:i], ms.activities[i+1:]...)
+			delete(ms.keys, activity.Key)
+			return activity, ms.addPoints(activity.User, activity.UserName, -activity.Reward), nil
+		}
+	}
+	return nil, nil, ErrNotFound
+}
+
+// CountActivities returns the number of activities matching the filter
+func (ms *MemoryStore) CountActivities(ctx context.Context, filter ActivityFilter) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	count := 0
+	for _, activity := range ms.activities {
+		if filter.matches(activity) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ListActivities returns the activities matching the filter, newest first
+func (ms *MemoryStore) ListActivities(ctx context.Context, filter ActivityFilter, skip, limit int) ([]Activity, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	// Activities are kept in the order they were applied
+	var activities []Activity
+	for i := len(ms.activities) - 1; i >= 0 && (limit == 0 || len(activities) < limit); i-- {
+		if !filter.matches(ms.activities[i]) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		activities = append(activities, *ms.activities[i])
+	}
+	return activities, nil
+}
+
+// DeleteActivities deletes every activity of the user
+func (ms *MemoryStore) DeleteActivities(ctx context.Context, userID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	kept := ms.activities[:0]
+	for _, activity := range ms.activities {
+		if activity.User != userID {
+			kept = append(kept, activity)
+		} else {
+			delete(ms.keys, activity.Key)
+		}
+	}
+	ms.activities = kept
+	return nil
+}
+
+// UserPoints returns the points of every user by user ID
+func (ms *MemoryStore) UserPoints(ctx context.Context) (map[string]int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	points := make(map[string]int, len(ms.users))
+	for id, user := range ms.users {
+		points[id] = user.Points
+	}
+	return points, nil
+}
+
+// SumActivities returns the sum of the rewards of the activities matching the filter
+func (ms *MemoryStore) SumActivities(ctx context.Context, filter ActivityFilter) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	total := 0
+	for _, activity := range ms.activities {
+		if filter.matches(activity) {
+			total += activity.Reward
+		}
+	}
+	return total, nil
+}
+
+// ActivityTotals returns the sum of the activity rewards of every user by user ID
+func (ms *MemoryStore) ActivityTotals(ctx context.Context) (map[string]int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	totals := make(map[string]int)
+	for _, activity := range ms.activities {
+		totals[activity.User] += activity.Reward
+	}
+	return totals, nil
+}
+
+// SetPoints overwrites the points of the user when they still equal current, or returns ErrNotFound
+func (ms *MemoryStore) SetPoints(ctx context.Context, userID string, current, points int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, ok := ms.users[userID]
+	if !ok || user.Points != current {
+		return ErrNotFound
+	}
+	user.Points = points
+	user.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// InsertAudit records the audit entries
+func (ms *MemoryStore) InsertAudit(ctx context.Context, entries []AuditEntry) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.audit = append(ms.audit, entries...)
+	return nil
+}
+
+// ListBlockedReactions returns every blocked reaction
+func (ms *MemoryStore) ListBlockedReactions(ctx context.Context) ([]BlockedReaction, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	return append([]BlockedReaction(nil), ms.blocked...), nil
+}
+
+// AddBlockedReaction blocks the emoji, or returns ErrAlreadyExists
+func (ms *MemoryStore) AddBlockedReaction(ctx context.Context, blocked *BlockedReaction) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, b := range ms.blocked {
+		if b.Emoji == blocked.Emoji && b.ChannelID == blocked.ChannelID {
+			return ErrAlreadyExists
+		}
+	}
+	ms.blocked = append(ms.blocked, *blocked)
+	return nil
+}
+
+// RemoveBlockedReaction unblocks the emoji in the channel, or returns ErrNotFound
+func (ms *MemoryStore) RemoveBlockedReaction(ctx context.Context, emoji, channelID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for i, b := range ms.blocked {
+		if b.Emoji == emoji && b.ChannelID == channelID {
+			ms.blocked = append(ms.blocked[:i], ms.blocked[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ListShopItems returns every item of the shop, cheapest first
+func (ms *MemoryStore) ListShopItems(ctx context.Context) ([]ShopItem, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	items := make([]ShopItem, 0, len(ms.items))
+	for _, item := range ms.items {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Price != items[j].Price {
+			return items[i].Price < items[j].Price
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items, nil
+}
+
+// GetShopItem returns the item with the given ID, or ErrNotFound
+func (ms *MemoryStore) GetShopItem(ctx context.Context, itemID string) (*ShopItem, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	item, ok := ms.items[itemID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *item
+	return &copied, nil
+}
+
+// AddShopItem puts the item up for sale, or returns ErrAlreadyExists
+func (ms *MemoryStore) AddShopItem(ctx context.Context, item *ShopItem) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.items[item.ID]; ok {
+		return ErrAlreadyExists
+	}
+	copied := *item
+	ms.items[item.ID] = &copied
+	return nil
+}
+
+// RemoveShopItem takes the item off sale, or returns ErrNotFound
+func (ms *MemoryStore) RemoveShopItem(ctx context.Context, itemID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.items[itemID]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.items, itemID)
+	return nil
+}
+
+// SetShopStock sets the items left, -1 for unlimited, or returns ErrNotFound
+func (ms *MemoryStore) SetShopStock(ctx context.Context, itemID string, stock int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	item, ok := ms.items[itemID]
+	if !ok {
+		return ErrNotFound
+	}
+	item.Stock = stock
+	item.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// TakeShopStock takes one item from its stock and returns the item, or returns ErrOutOfStock
+func (ms *MemoryStore) TakeShopStock(ctx context.Context, itemID string) (*ShopItem, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	item, ok := ms.items[itemID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if item.Stock == 0 {
+		return nil, ErrOutOfStock
+	}
+	if !item.Unlimited() {
+		item.Stock--
+	}
+	copied := *item
+	return &copied, nil
+}
+
+// ReturnShopStock puts an item taken with TakeShopStock back into its stock
+func (ms *MemoryStore) ReturnShopStock(ctx context.Context, itemID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if item, ok := ms.items[itemID]; ok && !item.Unlimited() {
+		item.Stock++
+	}
+	return nil
+}
+
+// InsertPurchase records the purchase
+func (ms *MemoryStore) InsertPurchase(ctx context.Context, purchase *Purchase) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	copied := *purchase
+	ms.purchases = append(ms.purchases, &copied)
+	return nil
+}
+
+// DeletePurchase deletes the purchase with the given ID, for refunds
+func (ms *MemoryStore) DeletePurchase(ctx context.Context, purchaseID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for i, purchase := range ms.purchases {
+		if purchase.ID == purchaseID {
+			ms.purchases = append(ms.purchases[:i], ms.purchases[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// ListPurchases returns the purchases matching the filter, newest first, at most limit or all when 0
+func (ms *MemoryStore) ListPurchases(ctx context.Context, filter PurchaseFilter, limit int) ([]Purchase, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var purchases []Purchase
+	for i := len(ms.purchases) - 1; i >= 0; i-- {
+		if filter.matches(ms.purchases[i]) {
+			purchases = append(purchases, *ms.purchases[i])
+		}
+	}
+	sort.SliceStable(purchases, func(i, j int) bool {
+		return purchases[i].CreatedAt.After(purchases[j].CreatedAt)
+	})
+	if limit > 0 && len(purchases) > limit {
+		purchases = purchases[:limit]
+	}
+	return purchases, nil
+}
+
+// ExpirePurchase marks the role of the temprole purchase as removed
+func (ms *MemoryStore) ExpirePurchase(ctx context.Context, purchaseID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, purchase := range ms.purchases {
+		if purchase.ID == purchaseID {
+			purchase.Expired = true
+		}
+	}
+	return nil
+}
+
+// MarkDrawn marks the raffle tickets as drawn, so that they don't take part in the next draw
+func (ms *MemoryStore) MarkDrawn(ctx context.Context, purchaseIDs []string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	drawn := make(map[string]bool, len(purchaseIDs))
+	for _, id := range purchaseIDs {
+		drawn[id] = true
+	}
+	for _, purchase := range ms.purchases {
+		if drawn[purchase.ID] {
+			purchase.Drawn = true
+		}
+	}
+	return nil
+}
+
+// SetBackground sets the rank card background of the user, or returns ErrNotFound
+func (ms *MemoryStore) SetBackground(ctx context.Context, userID, background string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	user, ok := ms.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Background = background
+	return nil
+}
+
+// addPoints adds points to the user, creating the user when it does not exist yet,
+// and returns a copy of the updated user. The caller must hold the lock.
+func (ms *MemoryStore) addPoints(userID, userName string, points int) *User {
+	now := time.Now().UTC()
+	user := ms.getOrCreate(userID, userName, now, now)
+	if points != 0 {
+		user.Points += points
+		user.UpdatedAt = now
+	}
+
+	copied := *user
+	return &copied
+}
+
+// getOrCreate returns the user with the given ID, creating it when it does not exist.
+// The caller must hold the lock.
+func (ms *MemoryStore) getOrCreate(userID, userName string, joinedDate, now time.Time) *User {
+	user, ok := ms.users[userID]
+	if !ok {
+		user = &User{
+			ID:         userID,
+			UserName:   userName,
+			JoinedDate: joinedDate,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		ms.users[userID] = user
+	}
+	return user
+}
+
+// leaderboard returns the active users ranked by the points they earned since the given time,
+// or by their total points when since is zero. The caller must hold the lock.
+func (ms *MemoryStore) leaderboard(since time.Time) []LeaderboardEntry {
+	var entries []LeaderboardEntry
+	if since.IsZero() {
+		for _, user := range ms.ranked() {
+			entries = append(entries, LeaderboardEntry{UserID: user.ID, UserName: user.UserName, Points: user.Points, UpdatedAt: user.UpdatedAt})
+		}
+		return entries
+	}
+
+	byUser := make(map[string]*LeaderboardEntry)
+	for _, activity := range ms.activities {
+		if activity.CreatedAt.Before(since) {
+			continue
+		}
+		if user, ok := ms.users[activity.User]; ok && !user.Active() {
+			continue
+		}
+		entry, ok := byUser[activity.User]
+		if !ok {
+			entry = &LeaderboardEntry{UserID: activity.User}
+			byUser[activity.User] = entry
+		}
+		entry.UserName = activity.UserName
+		entry.Points += activity.Reward
+		if activity.CreatedAt.After(entry.UpdatedAt) {
+			entry.UpdatedAt = activity.CreatedAt
+		}
+	}
+	for _, entry := range byUser {
+		if entry.Points > 0 {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ranksBefore(&entries[j])
+	})
+	return entries
+}
+
+// ranked returns copies of the active users ordered by points, earliest updated first on ties.
+// The caller must hold the lock.
+func (ms *MemoryStore) ranked() []User {
+	users := make([]User, 0, len(ms.users))
+	for _, user := range ms.users {
+		if user.Active() {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Points != users[j].Points {
+			return users[i].Points > users[j].Points
+		}
+		if !users[i].UpdatedAt.Equal(users[j].UpdatedAt) {
+			return users[i].UpdatedAt.Before(users[j].UpdatedAt)
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// seedUsers adds the users to the store as they are, so that tests choose their points and
+// when they were updated
+func seedUsers(ms *MemoryStore, users ...User) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for i := range users {
+		user := users[i]
+		ms.users[user.ID] = &user
+	}
+}
+
+func TestMemoryUserRankTies(t *testing.T) {
+	ms := NewMemoryStore()
+	seedUsers(ms, rankTieUsers()...)
+	testRankTies(t, ms)
+}
+
+// rankTieUsers returns users tied on their points and on when they were updated,
+// and a user who left
+func rankTieUsers() []User {
+	early := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	return []User{
+		{ID: "u5", Points: 100, UpdatedAt: late},
+		{ID: "u4", Points: 100, UpdatedAt: early},
+		{ID: "u3", Points: 100, UpdatedAt: early},
+		{ID: "u2", Points: 200, UpdatedAt: late},
+		{ID: "u1", Points: 50, UpdatedAt: early},
+		{ID: "u0", Points: 200, UpdatedAt: early, LeftAt: early},
+	}
+}
+
+// testRankTies checks that UserRank, TopUsers and the leaderboard of all time rank the
+// rankTieUsers seeded in the store in the same order
+func testRankTies(t *testing.T, store Store) {
+	ctx := context.Background()
+	want := []string{"u2", "u3", "u4", "u5", "u1"}
+
+	entries, total, err := store.Leaderboard(ctx, time.Time{}, 0, 10)
+	if err != nil {
+		t.Fatalf("Leaderboard: %v", err)
+	}
+	if total != len(want) || len(entries) != len(want) {
+		t.Fatalf("Leaderboard returned %d of %d users, want %d", len(entries), total, len(want))
+	}
+	top, err := store.TopUsers(ctx, 10)
+	if err != nil {
+		t.Fatalf("TopUsers: %v", err)
+	}
+	if len(top) != len(want) {
+		t.Fatalf("TopUsers returned %d users, want %d", len(top), len(want))
+	}
+	for i, userID := range want {
+		if entries[i].UserID != userID {
+			t.Errorf("leaderboard rank %d = %s, want %s", i+1, entries[i].UserID, userID)
+		}
+		if top[i].ID != userID {
+			t.Errorf("TopUsers rank %d = %s, want %s", i+1, top[i].ID, userID)
+		}
+		rank, ranked, err := store.UserRank(ctx, userID)
+		if err != nil {
+			t.Fatalf("UserRank(%s): %v", userID, err)
+		}
+		if rank != i+1 || ranked != total {
+			t.Errorf("UserRank(%s) = %d of %d, want %d of %d", userID, rank, ranked, i+1, total)
+		}
+	}
+
+	rank, _, err := store.UserRank(ctx, "u0")
+	if err != nil {
+		t.Fatalf("UserRank(u0): %v", err)
+	}
+	if rank != 0 {
+		t.Errorf("UserRank of a user who left = %d, want 0", rank)
+	}
+}
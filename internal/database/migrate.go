@@ -0,0 +1,252 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration represents a versioned change to the indexes or documents of the database.
+// Migrations must be safe to run again, in case one is interrupted before being recorded.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, ms *MongoStore) error
+}
+
+// migrationRecord represents a migration applied to the database
+type migrationRecord struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+// migrations lists every migration in the order they are applied
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Create the unique index on activity keys and the activity lookup indexes",
+		Up:          createActivityIndexes,
+	},
+	{
+		Version:     2,
+		Description: "Create the user ranking index",
+		Up:          createUserIndexes,
+	},
+	{
+		Version:     3,
+		Description: "Create the unique index on blocked reactions",
+		Up:          createBlockedReactionIndexes,
+	},
+	{
+		Version:     4,
+		Description: "Backfill missing streak, joined and updated fields of users",
+		Up:          backfillUserFields,
+	},
+	{
+		Version:     5,
+		Description: "Backfill the day of attend activities and create the unique daily attendance index",
+		Up:          createDailyAttendanceIndex,
+	},
+	{
+		Version:     6,
+		Description: "Create the purchase history and temporary role expiry indexes",
+		Up:          createPurchaseIndexes,
+	},
+}
+
+// Migrate applies the migrations that were not applied yet, in order, and returns them.
+// With dryRun set, it only returns the migrations that would be applied.
+func (ms *MongoStore) Migrate(ctx context.Context, dryRun bool) ([]Migration, error) {
+	pending, err := ms.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return pending, nil
+	}
+
+	for i, migration := range pending {
+		if err := migration.Up(ctx, ms); err != nil {
+			return pending[:i], fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
+		}
+		_, err := ms.migrations().InsertOne(ctx, migrationRecord{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC(),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return pending[:i], fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+	}
+	return pending, nil
+}
+
+// PendingMigrations returns the migrations that were not applied yet, in order
+func (ms *MongoStore) PendingMigrations(ctx context.Context) ([]Migration, error) {
+	cursor, err := ms.migrations().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find applied migrations: %w", err)
+	}
+	var records []migrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode applied migrations: %w", err)
+	}
+	applied := make(map[int]bool, len(records))
+	for _, record := range records {
+		applied[record.Version] = true
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+func (ms *MongoStore) migrations() *mongo.Collection {
+	return GetMigrationsColl(ms.client, ms.cfg)
+}
+
+// createActivityIndexes creates the indexes used to apply and look up activities
+func createActivityIndexes(ctx context.Context, ms *MongoStore) error {
+	_, err := ms.activities().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// The idempotency key of activities must be unique, activities without a key are not indexed
+		{
+			Keys: bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"key": bson.M{"$exists": true}}),
+		},
+		// Activities of a user, newest first, for the history and the daily caps
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "createdAt", Value: -1}}},
+		// Activities of a period, for the leaderboards
+		{Keys: bson.D{{Key: "createdAt", Value: 1}}},
+	})
+	return err
+}
+
+// createUserIndexes creates the index users are ranked with, earliest updated first on ties
+func createUserIndexes(ctx context.Context, ms *MongoStore) error {
+	_, err := ms.users().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "points", Value: -1}, {Key: "updatedAt", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	return err
+}
+
+// createBlockedReactionIndexes makes sure an emoji is blocked at most once per channel
+func createBlockedReactionIndexes(ctx context.Context, ms *MongoStore) error {
+	_, err := ms.blockedReactions().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "emoji", Value: 1}, {Key: "channelId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// backfillUserFields sets the fields added to users after they were first created
+func backfillUserFields(ctx context.Context, ms *MongoStore) error {
+	for _, field := range []string{"currentStreak", "longestStreak", "streakFreezes"} {
+		_, err := ms.users().UpdateMany(ctx,
+			bson.M{field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{field: 0}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, field := range []string{"joinedDate", "updatedAt"} {
+		_, err := ms.users().UpdateMany(ctx,
+			bson.M{field: bson.M{"$exists": false}},
+			bson.A{bson.M{"$set": bson.M{field: "$createdAt"}}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDailyAttendanceIndex sets the calendar day of the attend activities that have none and
+// makes (user, day) unique among attend activities. When a user attended more than once on a day,
+// only one activity gets the day, so that the index can be created: the one that already has it,
+// or else the first one.
+func createDailyAttendanceIndex(ctx context.Context, ms *MongoStore) error {
+	// Activities with a day sort first, as strings sort after missing fields
+	opts := options.Find().
+		SetSort(bson.D{{Key: "day", Value: -1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetProjection(bson.M{"user": 1, "day": 1, "createdAt": 1})
+	cursor, err := ms.activities().Find(ctx, bson.M{"activity": ActivityAttend}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	loc := ms.cfg.Location()
+	seen := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var activity struct {
+			ID        interface{} `bson:"_id"`
+			User      string      `bson:"user"`
+			Day       string      `bson:"day"`
+			CreatedAt time.Time   `bson:"createdAt"`
+		}
+		if err := cursor.Decode(&activity); err != nil {
+			return err
+		}
+
+		day := activity.Day
+		if day == "" {
+			day = activity.CreatedAt.In(loc).Format("2006-01-02")
+		}
+		if seen[activity.User+":"+day] {
+			continue
+		}
+		seen[activity.User+":"+day] = true
+
+		if activity.Day == "" {
+			_, err := ms.activities().UpdateByID(ctx, activity.ID, bson.M{"$set": bson.M{"day": day}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	_, err = ms.activities().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user", Value: 1}, {Key: "day", Value: 1}},
+		Options: options.Index().
+			SetName("daily_attendance").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{
+				"activity": ActivityAttend,
+				"day":      bson.M{"$exists": true},
+			}),
+	})
+	return err
+}
+
+// createPurchaseIndexes creates the indexes used to look up purchases and expire temporary roles
+func createPurchaseIndexes(ctx context.Context, ms *MongoStore) error {
+	_, err := ms.purchases().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Purchases of a user, newest first, for the purchase history
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "createdAt", Value: -1}}},
+		// Purchases of an item, for the raffle draws
+		{Keys: bson.D{{Key: "item", Value: 1}, {Key: "createdAt", Value: -1}}},
+		// Temporary roles which are still given, by when they expire
+		{
+			Keys: bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().
+				SetName("temprole_expiry").
+				SetPartialFilterExpression(bson.M{"kind": ShopTempRole, "expired": false}),
+		},
+	})
+	return err
+}
@@ -3,22 +3,136 @@ package database
 import "time"
 
 type User struct {
-	ID         string    `bson:"_id" json:"id"`
-	UserName   string    `bson:"userName" json:"userName"`
-	Points     int       `bson:"points" json:"points"`
-	JoinedDate time.Time `bson:"joinedDate" json:"joinedDate"`
-	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
-	UpdatedAt  time.Time `bson:"updatedAt" json:"updatedAt"`
+	ID             string    `bson:"_id" json:"id"`
+	UserName       string    `bson:"userName" json:"userName"`
+	Points         int       `bson:"points" json:"points"`
+	LastAttendance time.Time `bson:"lastAttendance,omitempty" json:"lastAttendance"`
+	CurrentStreak  int       `bson:"currentStreak" json:"currentStreak"`
+	LongestStreak  int       `bson:"longestStreak" json:"longestStreak"`
+	StreakFreezes  int       `bson:"streakFreezes" json:"streakFreezes"`
+	JoinedDate     time.Time `bson:"joinedDate" json:"joinedDate"`
+	LeftAt         time.Time `bson:"leftAt,omitempty" json:"leftAt"`                   // set while the user is not a member of the guild
+	Background     string    `bson:"background,omitempty" json:"background,omitempty"` // rank card background bought in the shop
+	CreatedAt      time.Time `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Active reports whether the user is still a member of the guild
+func (u *User) Active() bool {
+	return u.LeftAt.IsZero()
 }
 
 type Activity struct {
 	User      string    `json:"user" bson:"user" required:"true"`
 	UserName  string    `json:"userName" bson:"userName"`
 	ChannelId string    `json:"channelId" bson:"channelId" required:"true"`
-	Activity  string    `json:"activity" bson:"activity" required:"true" enum:"attend,react,receive,play"`
-	Reward    int       `json:"reward" bson:"reward" required:"true" enum:"-10,5,10,50"`
+	Activity  string    `json:"activity" bson:"activity" required:"true" enum:"attend,streak,react,receive,play,trivia,wager,payout,purchase,adjust,penalty"`
+	Reward    int       `json:"reward" bson:"reward" required:"true"`
 	MessageId string    `json:"messageId" bson:"messageId"`
 	Emoji     string    `json:"emoji" bson:"emoji"`
+	FromUser  string    `json:"fromUser,omitempty" bson:"fromUser,omitempty"`       // user who reacted, for receive activities
+	Key       string    `json:"key,omitempty" bson:"key,omitempty"`                 // idempotency key, unique across activities
+	Moderator string    `json:"moderatorId,omitempty" bson:"moderatorId,omitempty"` // admin who changed the points, for adjust activities
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	Day       string    `json:"day,omitempty" bson:"day,omitempty"`   // calendar day (YYYY-MM-DD) of attend activities
+	Game      string    `json:"game,omitempty" bson:"game,omitempty"` // game played, for play, wager and payout activities
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
 }
+
+// Activity types recorded in the activities collection
+const (
+	ActivityAttend   = "attend"
+	ActivityStreak   = "streak"
+	ActivityReact    = "react"
+	ActivityReceive  = "receive"
+	ActivityPlay     = "play"
+	ActivityTrivia   = "trivia"
+	ActivityWager    = "wager"    // stake taken when a bet is placed
+	ActivityPayout   = "payout"   // winnings of a bet, stake included
+	ActivityPurchase = "purchase" // price of an item bought in the shop
+	ActivityAdjust   = "adjust"
+	ActivityPenalty  = "penalty"
+)
+
+// AuditEntry represents a change made by the bot, recorded in the audit collection
+type AuditEntry struct {
+	Event     string    `json:"event" bson:"event"`
+	UserID    string    `json:"userId,omitempty" bson:"userId,omitempty"`     // user the event is about
+	UserName  string    `json:"userName,omitempty" bson:"userName,omitempty"` // name of the user, when known
+	ActorID   string    `json:"actorId,omitempty" bson:"actorId,omitempty"`   // user who caused the event, when not the user
+	ChannelID string    `json:"channelId,omitempty" bson:"channelId,omitempty"`
+	Source    string    `json:"source,omitempty" bson:"source,omitempty"` // activity, emoji or command behind the event
+	Before    *int      `json:"before,omitempty" bson:"before,omitempty"` // points before the event
+	After     *int      `json:"after,omitempty" bson:"after,omitempty"`   // points after the event
+	Details   string    `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Audit events recorded in the audit collection
+const (
+	AuditPoints          = "points"
+	AuditPointsReverted  = "points_reverted"
+	AuditRevertSkipped   = "revert_skipped"
+	AuditReactionRemoved = "reaction_removed"
+	AuditMemberJoin      = "member_join"
+	AuditMemberLeave     = "member_leave"
+	AuditMembersPurged   = "members_purged"
+	AuditMemberTimeout   = "member_timeout"
+	AuditCommand         = "command"
+	AuditCommandDenied   = "command_denied"
+	AuditRoleExpired     = "role_expired"
+	AuditPayoutOwed      = "payout_owed"
+)
+
+// BlockedReaction represents an emoji that is removed when used as a reaction
+type BlockedReaction struct {
+	Emoji     string    `json:"emoji" bson:"emoji"`         // unicode emoji, or name:id for custom emojis
+	ChannelID string    `json:"channelId" bson:"channelId"` // empty for every channel
+	AddedBy   string    `json:"addedBy" bson:"addedBy"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// ShopItem represents an item admins put up for sale in the shop
+type ShopItem struct {
+	ID         string        `json:"id" bson:"_id"` // short name the item is bought with
+	Name       string        `json:"name" bson:"name"`
+	Kind       string        `json:"kind" bson:"kind" enum:"role,temprole,background,raffle"`
+	Price      int           `json:"price" bson:"price"`
+	Stock      int           `json:"stock" bson:"stock"`                               // items left, -1 when unlimited
+	RoleID     string        `json:"roleId,omitempty" bson:"roleId,omitempty"`         // role given, for role and temprole items
+	Duration   time.Duration `json:"duration,omitempty" bson:"duration,omitempty"`     // how long a temprole is kept
+	Background string        `json:"background,omitempty" bson:"background,omitempty"` // hex color or image URL, for background items
+	CreatedBy  string        `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time     `json:"createdAt" bson:"createdAt"`
+	UpdatedAt  time.Time     `json:"updatedAt" bson:"updatedAt"`
+}
+
+// Unlimited reports whether the item never runs out of stock
+func (i *ShopItem) Unlimited() bool {
+	return i.Stock < 0
+}
+
+// Kinds of shop items
+const (
+	ShopRole       = "role"       // role kept for good
+	ShopTempRole   = "temprole"   // role removed once its duration is over
+	ShopBackground = "background" // background of the rank card
+	ShopRaffle     = "raffle"     // ticket entered into a raffle drawn by admins
+)
+
+// Purchase represents an item bought in the shop, recorded in the purchases collection
+type Purchase struct {
+	ID        string    `json:"id" bson:"_id"` // message of the !buy command
+	User      string    `json:"user" bson:"user"`
+	UserName  string    `json:"userName" bson:"userName"`
+	Item      string    `json:"item" bson:"item"`
+	Name      string    `json:"name" bson:"name"`
+	Kind      string    `json:"kind" bson:"kind"`
+	Price     int       `json:"price" bson:"price"`
+	RoleID    string    `json:"roleId,omitempty" bson:"roleId,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"` // when the role of a temprole is removed
+	Expired   bool      `json:"expired" bson:"expired"`                         // set once the role of a temprole is removed
+	Drawn     bool      `json:"drawn,omitempty" bson:"drawn,omitempty"`         // set once a raffle ticket took part in a draw
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
@@ -45,3 +45,28 @@ func GetUsersColl(mongoClient *mongo.Client, cfg *config.Config) *mongo.Collecti
 func GetActivitiesColl(mongoClient *mongo.Client, cfg *config.Config) *mongo.Collection {
 	return mongoClient.Database(cfg.MongoDBName).Collection("activities")
 }
+
+// GetAuditColl returns the MongoDB collection of audit entries
+func GetAuditColl(mongoClient *mongo.Client, cfg *config.Config) *mongo.Collection {
+	return mongoClient.Database(cfg.MongoDBName).Collection("audit")
+}
+
+// GetBlockedReactionsColl returns the MongoDB collection of blocked reactions
+func GetBlockedReactionsColl(mongoClient *mongo.Client, cfg *config.Config) *mongo.Collection {
+	return mongoClient.Database(cfg.MongoDBName).Collection("blocked_reactions")
+}
+
+// GetMigrationsColl returns the MongoDB collection of applied migrations
+func GetMigrationsColl(mongoClient *mongo.Client, cfg *config.Config) *mongo.Collection {
+	return mongoClient.Database(cfg.MongoDBName).Collection("migrations")
+}
+
+// GetShopItemsColl returns the MongoDB collection of shop items
+func GetShopItemsColl(mongoClient *mongo.Client, cfg *config.Config) *mongo.Collection {
+	return mongoClient.Database(cfg.MongoDBName).Collection("shop_items")
+}
+
+// GetPurchasesColl returns the MongoDB collection of shop purchases
+func GetPurchasesColl(mongoClient *mongo.Client, cfg *config.Config) *mongo.Collection {
+	return mongoClient.Database(cfg.MongoDBName).Collection("purchases")
+}
@@ -0,0 +1,986 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore represents a Store backed by MongoDB
+type MongoStore struct {
+	client *mongo.Client
+	cfg    *config.Config
+}
+
+var _ Store = (*MongoStore)(nil)
+
+// NewMongoStore creates a new MongoStore instance
+func NewMongoStore(client *mongo.Client, cfg *config.Config) *MongoStore {
+	return &MongoStore{
+		client: client,
+		cfg:    cfg,
+	}
+}
+
+func (ms *MongoStore) users() *mongo.Collection {
+	return GetUsersColl(ms.client, ms.cfg)
+}
+
+func (ms *MongoStore) activities() *mongo.Collection {
+	return GetActivitiesColl(ms.client, ms.cfg)
+}
+
+func (ms *MongoStore) audit() *mongo.Collection {
+	return GetAuditColl(ms.client, ms.cfg)
+}
+
+func (ms *MongoStore) blockedReactions() *mongo.Collection {
+	return GetBlockedReactionsColl(ms.client, ms.cfg)
+}
+
+func (ms *MongoStore) shopItems() *mongo.Collection {
+	return GetShopItemsColl(ms.client, ms.cfg)
+}
+
+func (ms *MongoStore) purchases() *mongo.Collection {
+	return GetPurchasesColl(ms.client, ms.cfg)
+}
+
+// GetUser returns the user with the given ID, or ErrNotFound
+func (ms *MongoStore) GetUser(ctx context.Context, userID string) (*User, error) {
+	var user User
+	err := ms.users().FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	return &user, nil
+}
+
+// CreateUser inserts a new user
+func (ms *MongoStore) CreateUser(ctx context.Context, user *User) error {
+	_, err := ms.users().InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert user: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser deletes the user with the given ID
+func (ms *MongoStore) DeleteUser(ctx context.Context, userID string) error {
+	_, err := ms.users().DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return nil
+}
+
+// addPoints adds points to the user, creating the user when it does not exist yet. When no
+// points are added the user is left unchanged, as updatedAt breaks the ties of the rankings.
+func (ms *MongoStore) addPoints(ctx context.Context, userID, userName string, points int) (*User, error) {
+	now := time.Now().UTC()
+	onInsert := bson.M{
+		"userName":   userName,
+		"joinedDate": now,
+		"createdAt":  now,
+	}
+	update := bson.M{"$setOnInsert": onInsert}
+	if points != 0 {
+		update["$inc"] = bson.M{"points": points}
+		update["$set"] = bson.M{"updatedAt": now}
+	} else {
+		onInsert["points"] = 0
+		onInsert["updatedAt"] = now
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var user User
+	err := ms.users().FindOneAndUpdate(ctx, bson.M{"_id": userID}, update, opts).Decode(&user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user points: %w", err)
+	}
+	return &user, nil
+}
+
+// CheckIn records the daily attendance of the user, or returns ErrAlreadyCheckedIn
+func (ms *MongoStore) CheckIn(ctx context.Context, checkIn *CheckIn) (*User, error) {
+	// Only match the user if they have not checked in since the start of the day.
+	// When the user already checked in, the upsert collides with the existing _id
+	// and fails with a duplicate key error, so a check-in can never be counted twice.
+	filter := bson.M{
+		"_id": checkIn.UserID,
+		"$or": bson.A{
+			bson.M{"lastAttendance": bson.M{"$lt": checkIn.Since}},
+			bson.M{"lastAttendance": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{
+		"$inc": bson.M{
+			"streakFreezes": checkIn.StreakFreezes,
+		},
+		"$set": bson.M{
+			"userName":       checkIn.UserName,
+			"lastAttendance": checkIn.At,
+			"currentStreak":  checkIn.CurrentStreak,
+			"longestStreak":  checkIn.LongestStreak,
+			"updatedAt":      checkIn.At,
+		},
+		"$setOnInsert": bson.M{
+			"joinedDate": checkIn.JoinedDate,
+			"createdAt":  checkIn.At,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var user User
+	err := ms.users().FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrAlreadyCheckedIn
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record attendance: %w", err)
+	}
+	return &user, nil
+}
+
+// ListUsers returns every user, including the users who left
+func (ms *MongoStore) ListUsers(ctx context.Context) ([]User, error) {
+	cursor, err := ms.users().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode users: %w", err)
+	}
+	return users, nil
+}
+
+// UpdateMember updates the name and the date the user joined the guild, or returns ErrNotFound
+func (ms *MongoStore) UpdateMember(ctx context.Context, userID, userName string, joinedDate time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"userName":   userName,
+			"joinedDate": joinedDate,
+		},
+	}
+	result, err := ms.users().UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update member: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Leaderboard returns a page of the active users ranked by the points they earned since the given time
+func (ms *MongoStore) Leaderboard(ctx context.Context, since time.Time, skip, limit int) ([]LeaderboardEntry, int, error) {
+	if since.IsZero() {
+		total, err := ms.users().CountDocuments(ctx, activeUsers())
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count ranked users: %w", err)
+		}
+		opts := options.Find().
+			SetSort(bson.D{{Key: "points", Value: -1}, {Key: "updatedAt", Value: 1}, {Key: "_id", Value: 1}}).
+			SetSkip(int64(skip)).
+			SetLimit(int64(limit))
+		cursor, err := ms.users().Find(ctx, activeUsers(), opts)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to find ranked users: %w", err)
+		}
+		var entries []LeaderboardEntry
+		if err := cursor.All(ctx, &entries); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode ranked users: %w", err)
+		}
+		return entries, int(total), nil
+	}
+
+	pipeline := append(ms.periodPoints(since), bson.M{
+		"$facet": bson.M{
+			"entries": bson.A{bson.M{"$skip": skip}, bson.M{"$limit": limit}},
+			"total":   bson.A{bson.M{"$count": "count"}},
+		},
+	})
+	cursor, err := ms.activities().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to aggregate leaderboard: %w", err)
+	}
+	var results []struct {
+		Entries []LeaderboardEntry `bson:"entries"`
+		Total   []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode leaderboard: %w", err)
+	}
+	if len(results) == 0 || len(results[0].Total) == 0 {
+		return nil, 0, nil
+	}
+	return results[0].Entries, results[0].Total[0].Count, nil
+}
+
+// LeaderboardPosition returns the rank and the entry of the user on the leaderboard
+func (ms *MongoStore) LeaderboardPosition(ctx context.Context, since time.Time, userID string) (int, *LeaderboardEntry, error) {
+	if since.IsZero() {
+		user, err := ms.GetUser(ctx, userID)
+		if err == ErrNotFound {
+			return 0, nil, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		rank, _, err := ms.UserRank(ctx, userID)
+		if err != nil || rank == 0 {
+			return 0, nil, err
+		}
+		return rank, &LeaderboardEntry{UserID: user.ID, UserName: user.UserName, Points: user.Points, UpdatedAt: user.UpdatedAt}, nil
+	}
+
+	pipeline := append(ms.periodPoints(since), bson.M{"$match": bson.M{"_id": userID}})
+	cursor, err := ms.activities().Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to aggregate leaderboard entry: %w", err)
+	}
+	var entries []LeaderboardEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return 0, nil, fmt.Errorf("failed to decode leaderboard entry: %w", err)
+	}
+	if len(entries) == 0 {
+		return 0, nil, nil
+	}
+	entry := entries[0]
+
+	// The rank is one more than the number of users ranked before the user
+	pipeline = append(ms.periodPoints(since),
+		bson.M{"$match": bson.M{"$or": bson.A{
+			bson.M{"points": bson.M{"$gt": entry.Points}},
+			bson.M{"points": entry.Points, "updatedAt": bson.M{"$lt": entry.UpdatedAt}},
+			bson.M{"points": entry.Points, "updatedAt": entry.UpdatedAt, "_id": bson.M{"$lt": entry.UserID}},
+		}}},
+		bson.M{"$count": "count"},
+	)
+	cursor, err = ms.activities().Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to aggregate leaderboard rank: %w", err)
+	}
+	var counts []struct {
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return 0, nil, fmt.Errorf("failed to decode leaderboard rank: %w", err)
+	}
+	ahead := 0
+	if len(counts) > 0 {
+		ahead = counts[0].Count
+	}
+	return ahead + 1, &entry, nil
+}
+
+// periodPoints returns the aggregation pipeline on activities that ranks the active users
+// by the points they earned since the given time
+func (ms *MongoStore) periodPoints(since time.Time) bson.A {
+	return bson.A{
+		bson.M{"$match": bson.M{"createdAt": bson.M{"$gte": since}}},
+		bson.M{"$sort": bson.M{"createdAt": 1}},
+		bson.M{"$group": bson.M{
+			"_id":       "$user",
+			"userName":  bson.M{"$last": "$userName"},
+			"points":    bson.M{"$sum": "$reward"},
+			"updatedAt": bson.M{"$max": "$createdAt"},
+		}},
+		bson.M{"$match": bson.M{"points": bson.M{"$gt": 0}}},
+		bson.M{"$lookup": bson.M{
+			"from":         ms.users().Name(),
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "user",
+		}},
+		bson.M{"$match": bson.M{"user.leftAt": bson.M{"$exists": false}}},
+		bson.M{"$project": bson.M{"user": 0}},
+		bson.M{"$sort": bson.D{{Key: "points", Value: -1}, {Key: "updatedAt", Value: 1}, {Key: "_id", Value: 1}}},
+	}
+}
+
+// MarkLeft marks the user as having left the guild at the given time, or returns ErrNotFound
+func (ms *MongoStore) MarkLeft(ctx context.Context, userID string, at time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"leftAt":    at,
+			"updatedAt": at,
+		},
+	}
+	result, err := ms.users().UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to mark user as left: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RestoreUser marks the user as a member of the guild again, or returns ErrNotFound
+func (ms *MongoStore) RestoreUser(ctx context.Context, userID, userName string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"userName":  userName,
+			"updatedAt": time.Now().UTC(),
+		},
+		"$unset": bson.M{"leftAt": ""},
+	}
+	result, err := ms.users().UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// LeftUsers returns the users who left the guild before the given time
+func (ms *MongoStore) LeftUsers(ctx context.Context, before time.Time) ([]User, error) {
+	cursor, err := ms.users().Find(ctx, bson.M{"leftAt": bson.M{"$lt": before}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users who left: %w", err)
+	}
+
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode users who left: %w", err)
+	}
+	return users, nil
+}
+
+// TopUsers returns the active users with the most points, earliest updated first on ties
+func (ms *MongoStore) TopUsers(ctx context.Context, limit int) ([]User, error) {
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "points", Value: -1}, {Key: "updatedAt", Value: 1}, {Key: "_id", Value: 1}})
+	findOptions.SetLimit(int64(limit))
+	cursor, err := ms.users().Find(ctx, activeUsers(), findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find top users: %w", err)
+	}
+
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode top users: %w", err)
+	}
+	return users, nil
+}
+
+// UserRank returns the ranking of the user by points and the number of ranked users.
+// The rank is one more than the number of active users ranked before the user, in the
+// same order as TopUsers, so that it is answered from the points index.
+func (ms *MongoStore) UserRank(ctx context.Context, userID string) (int, int, error) {
+	total, err := ms.users().CountDocuments(ctx, activeUsers())
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count ranked users: %w", err)
+	}
+
+	user, err := ms.GetUser(ctx, userID)
+	if err == ErrNotFound {
+		return 0, int(total), nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if !user.Active() {
+		return 0, int(total), nil
+	}
+
+	ahead := activeUsers()
+	ahead["$or"] = bson.A{
+		bson.M{"points": bson.M{"$gt": user.Points}},
+		bson.M{"points": user.Points, "updatedAt": bson.M{"$lt": user.UpdatedAt}},
+		bson.M{"points": user.Points, "updatedAt": user.UpdatedAt, "_id": bson.M{"$lt": user.ID}},
+	}
+	count, err := ms.users().CountDocuments(ctx, ahead)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count users ranked before user: %w", err)
+	}
+	return int(count) + 1, int(total), nil
+}
+
+// ApplyActivity records the activity and adds its reward to the points of the user.
+// MongoDB transactions need a replica set, so when the points cannot be updated the
+// inserted activity is deleted again to keep the ledger and the points in line.
+func (ms *MongoStore) ApplyActivity(ctx context.Context, activity *Activity) (*User, error) {
+	result, err := ms.activities().InsertOne(ctx, activity)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateActivity
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert activity: %w", err)
+	}
+
+	user, err := ms.addPoints(ctx, activity.User, activity.UserName, activity.Reward)
+	if err != nil {
+		compensateCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, delErr := ms.activities().DeleteOne(compensateCtx, bson.M{"_id": result.InsertedID})
+		if delErr != nil {
+			return nil, fmt.Errorf("failed to delete activity %v after %v: %w", result.InsertedID, err, delErr)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// ApplyDebit records the activity and takes its cost from the points of the user, when they
+// have enough. The points are only taken when the user has at least the cost, so concurrent
+// debits never take the points below zero; the activity is deleted again when they are not.
+func (ms *MongoStore) ApplyDebit(ctx context.Context, activity *Activity) (*User, error) {
+	cost := -activity.Reward
+	if cost <= 0 {
+		return nil, fmt.Errorf("debit activity must have a negative reward, got %d", activity.Reward)
+	}
+
+	result, err := ms.activities().InsertOne(ctx, activity)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateActivity
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert activity: %w", err)
+	}
+
+	user, err := ms.takePoints(ctx, activity.User, cost)
+	if err == nil {
+		return user, nil
+	}
+
+	compensateCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, delErr := ms.activities().DeleteOne(compensateCtx, bson.M{"_id": result.InsertedID})
+	if delErr != nil {
+		return nil, fmt.Errorf("failed to delete activity %v after %v: %w", result.InsertedID, err, delErr)
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInsufficientPoints
+	}
+	return nil, fmt.Errorf("failed to update user points: %w", err)
+}
+
+// takePoints takes the cost from the points of the user only when they have at least the cost,
+// returning mongo.ErrNoDocuments when they don't
+func (ms *MongoStore) takePoints(ctx context.Context, userID string, cost int) (*User, error) {
+	update := bson.M{
+		"$inc": bson.M{"points": -cost},
+		"$set": bson.M{"updatedAt": time.Now().UTC()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var user User
+	err := ms.users().FindOneAndUpdate(ctx, bson.M{"_id": userID, "points": bson.M{"$gte": cost}}, update, opts).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ApplyAdjust records the activity and adds its reward to the points of the user, when they still
+// have current points. The activity is deleted again when the points changed in between. A missing
+// user is only created when current is 0, the upsert colliding with an existing user otherwise.
+func (ms *MongoStore) ApplyAdjust(ctx context.Context, activity *Activity, current int) (*User, error) {
+	result, err := ms.activities().InsertOne(ctx, activity)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDuplicateActivity
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert activity: %w", err)
+	}
+
+	now := time.Now().UTC()
+	update := bson.M{
+		"$inc": bson.M{"points": activity.Reward},
+		"$set": bson.M{"updatedAt": now},
+		"$setOnInsert": bson.M{
+			"userName":   activity.UserName,
+			"joinedDate": now,
+			"createdAt":  now,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(current == 0).SetReturnDocument(options.After)
+	var user User
+	err = ms.users().FindOneAndUpdate(ctx, bson.M{"_id": activity.User, "points": current}, update, opts).Decode(&user)
+	if err == nil {
+		return &user, nil
+	}
+
+	compensateCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, delErr := ms.activities().DeleteOne(compensateCtx, bson.M{"_id": result.InsertedID})
+	if delErr != nil {
+		return nil, fmt.Errorf("failed to delete activity %v after %v: %w", result.InsertedID, err, delErr)
+	}
+	if err == mongo.ErrNoDocuments || mongo.IsDuplicateKeyError(err) {
+		return nil, ErrPointsChanged
+	}
+	return nil, fmt.Errorf("failed to update user points: %w", err)
+}
+
+// RevertActivity deletes one activity matching the filter and takes its reward back from the user.
+// A reward is only taken back when the user still has it, like a debit. When the points cannot
+// be updated the activity is inserted again.
+func (ms *MongoStore) RevertActivity(ctx context.Context, filter ActivityFilter) (*Activity, *User, error) {
+	var activity Activity
+	err := ms.activities().FindOneAndDelete(ctx, activityQuery(filter)).Decode(&activity)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to delete activity: %w", err)
+	}
+
+	var user *User
+	if activity.Reward > 0 {
+		user, err = ms.takePoints(ctx, activity.User, activity.Reward)
+		if err == mongo.ErrNoDocuments {
+			err = ErrInsufficientPoints
+		}
+	} else {
+		user, err = ms.addPoints(ctx, activity.User, activity.UserName, -activity.Reward)
+	}
+	if err != nil {
+		compensateCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, insErr := ms.activities().InsertOne(compensateCtx, &activity)
+		if insErr != nil {
+			return nil, nil, fmt.Errorf("failed to restore activity after %v: %w", err, insErr)
+		}
+		return nil, nil, err
+	}
+	return &activity, user, nil
+}
+
+// CountActivities returns the number of activities matching the filter
+func (ms *MongoStore) CountActivities(ctx context.Context, filter ActivityFilter) (int, error) {
+	count, err := ms.activities().CountDocuments(ctx, activityQuery(filter))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count activities: %w", err)
+	}
+	return int(count), nil
+}
+
+// SumActivities returns the sum of the rewards of the activities matching the filter
+func (ms *MongoStore) SumActivities(ctx context.Context, filter ActivityFilter) (int, error) {
+	pipeline := bson.A{
+		bson.M{"$match": activityQuery(filter)},
+		bson.M{
+			"$group": bson.M{
+				"_id":   nil,
+				"total": bson.M{"$sum": "$reward"},
+			},
+		},
+	}
+	cursor, err := ms.activities().Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum activities: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total int `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, fmt.Errorf("failed to decode activity sum: %w", err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, fmt.Errorf("failed to sum activities: %w", err)
+	}
+	return result.Total, nil
+}
+
+// ListActivities returns the activities matching the filter, newest first
+func (ms *MongoStore) ListActivities(ctx context.Context, filter ActivityFilter, skip, limit int) ([]Activity, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+	cursor, err := ms.activities().Find(ctx, activityQuery(filter), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find activities: %w", err)
+	}
+
+	var activities []Activity
+	if err := cursor.All(ctx, &activities); err != nil {
+		return nil, fmt.Errorf("failed to decode activities: %w", err)
+	}
+	return activities, nil
+}
+
+// DeleteActivities deletes every activity of the user
+func (ms *MongoStore) DeleteActivities(ctx context.Context, userID string) error {
+	_, err := ms.activities().DeleteMany(ctx, bson.M{"user": userID})
+	if err != nil {
+		return fmt.Errorf("failed to delete activities: %w", err)
+	}
+	return nil
+}
+
+// UserPoints returns the points of every user by user ID
+func (ms *MongoStore) UserPoints(ctx context.Context) (map[string]int, error) {
+	opts := options.Find().SetProjection(bson.M{"points": 1})
+	cursor, err := ms.users().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	points := make(map[string]int)
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, fmt.Errorf("failed to decode user: %w", err)
+		}
+		points[user.ID] = user.Points
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+	return points, nil
+}
+
+// ActivityTotals returns the sum of the activity rewards of every user by user ID
+func (ms *MongoStore) ActivityTotals(ctx context.Context) (map[string]int, error) {
+	pipeline := bson.A{
+		bson.M{
+			"$group": bson.M{
+				"_id":   "$user",
+				"total": bson.M{"$sum": "$reward"},
+			},
+		},
+	}
+	cursor, err := ms.activities().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregation pipeline: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	totals := make(map[string]int)
+	for cursor.Next(ctx) {
+		var result struct {
+			User  string `bson:"_id"`
+			Total int    `bson:"total"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, fmt.Errorf("error decoding: %w", err)
+		}
+		totals[result.User] = result.Total
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error decoding: %w", err)
+	}
+	return totals, nil
+}
+
+// SetPoints overwrites the points of the user when they still equal current, or returns ErrNotFound
+func (ms *MongoStore) SetPoints(ctx context.Context, userID string, current, points int) error {
+	update := bson.M{
+		"$set": bson.M{
+			"points":    points,
+			"updatedAt": time.Now().UTC(),
+		},
+	}
+	result, err := ms.users().UpdateOne(ctx, bson.M{"_id": userID, "points": current}, update)
+	if err != nil {
+		return fmt.Errorf("failed to set user points: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// InsertAudit records the audit entries
+func (ms *MongoStore) InsertAudit(ctx context.Context, entries []AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(entries))
+	for i := range entries {
+		docs[i] = entries[i]
+	}
+	_, err := ms.audit().InsertMany(ctx, docs)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entries: %w", err)
+	}
+	return nil
+}
+
+// ListBlockedReactions returns every blocked reaction
+func (ms *MongoStore) ListBlockedReactions(ctx context.Context) ([]BlockedReaction, error) {
+	cursor, err := ms.blockedReactions().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find blocked reactions: %w", err)
+	}
+
+	var blocked []BlockedReaction
+	if err := cursor.All(ctx, &blocked); err != nil {
+		return nil, fmt.Errorf("failed to decode blocked reactions: %w", err)
+	}
+	return blocked, nil
+}
+
+// AddBlockedReaction blocks the emoji, or returns ErrAlreadyExists
+func (ms *MongoStore) AddBlockedReaction(ctx context.Context, blocked *BlockedReaction) error {
+	_, err := ms.blockedReactions().InsertOne(ctx, blocked)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert blocked reaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveBlockedReaction unblocks the emoji in the channel, or returns ErrNotFound
+func (ms *MongoStore) RemoveBlockedReaction(ctx context.Context, emoji, channelID string) error {
+	result, err := ms.blockedReactions().DeleteOne(ctx, bson.M{"emoji": emoji, "channelId": channelID})
+	if err != nil {
+		return fmt.Errorf("failed to delete blocked reaction: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListShopItems returns every item of the shop, cheapest first
+func (ms *MongoStore) ListShopItems(ctx context.Context) ([]ShopItem, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "price", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := ms.shopItems().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find shop items: %w", err)
+	}
+
+	var items []ShopItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode shop items: %w", err)
+	}
+	return items, nil
+}
+
+// GetShopItem returns the item with the given ID, or ErrNotFound
+func (ms *MongoStore) GetShopItem(ctx context.Context, itemID string) (*ShopItem, error) {
+	var item ShopItem
+	err := ms.shopItems().FindOne(ctx, bson.M{"_id": itemID}).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find shop item: %w", err)
+	}
+	return &item, nil
+}
+
+// AddShopItem puts the item up for sale, or returns ErrAlreadyExists
+func (ms *MongoStore) AddShopItem(ctx context.Context, item *ShopItem) error {
+	_, err := ms.shopItems().InsertOne(ctx, item)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to insert shop item: %w", err)
+	}
+	return nil
+}
+
+// RemoveShopItem takes the item off sale, or returns ErrNotFound
+func (ms *MongoStore) RemoveShopItem(ctx context.Context, itemID string) error {
+	result, err := ms.shopItems().DeleteOne(ctx, bson.M{"_id": itemID})
+	if err != nil {
+		return fmt.Errorf("failed to delete shop item: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetShopStock sets the items left, -1 for unlimited, or returns ErrNotFound
+func (ms *MongoStore) SetShopStock(ctx context.Context, itemID string, stock int) error {
+	result, err := ms.shopItems().UpdateByID(ctx, itemID, bson.M{
+		"$set": bson.M{"stock": stock, "updatedAt": time.Now().UTC()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update shop stock: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TakeShopStock takes one item from its stock with a conditional update, so that the stock
+// never goes below zero, and returns the item. Unlimited items are returned unchanged.
+func (ms *MongoStore) TakeShopStock(ctx context.Context, itemID string) (*ShopItem, error) {
+	item, err := ms.GetShopItem(ctx, itemID)
+	if err != nil || item.Unlimited() {
+		return item, err
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = ms.shopItems().FindOneAndUpdate(ctx,
+		bson.M{"_id": itemID, "stock": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"stock": -1}},
+		opts,
+	).Decode(item)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOutOfStock
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to take shop stock: %w", err)
+	}
+	return item, nil
+}
+
+// ReturnShopStock puts an item taken with TakeShopStock back into its stock
+func (ms *MongoStore) ReturnShopStock(ctx context.Context, itemID string) error {
+	_, err := ms.shopItems().UpdateOne(ctx,
+		bson.M{"_id": itemID, "stock": bson.M{"$gte": 0}},
+		bson.M{"$inc": bson.M{"stock": 1}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to return shop stock: %w", err)
+	}
+	return nil
+}
+
+// InsertPurchase records the purchase
+func (ms *MongoStore) InsertPurchase(ctx context.Context, purchase *Purchase) error {
+	_, err := ms.purchases().InsertOne(ctx, purchase)
+	if err != nil {
+		return fmt.Errorf("failed to insert purchase: %w", err)
+	}
+	return nil
+}
+
+// DeletePurchase deletes the purchase with the given ID, for refunds
+func (ms *MongoStore) DeletePurchase(ctx context.Context, purchaseID string) error {
+	_, err := ms.purchases().DeleteOne(ctx, bson.M{"_id": purchaseID})
+	if err != nil {
+		return fmt.Errorf("failed to delete purchase: %w", err)
+	}
+	return nil
+}
+
+// ListPurchases returns the purchases matching the filter, newest first, at most limit or all when 0
+func (ms *MongoStore) ListPurchases(ctx context.Context, filter PurchaseFilter, limit int) ([]Purchase, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := ms.purchases().Find(ctx, purchaseQuery(filter), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find purchases: %w", err)
+	}
+
+	var purchases []Purchase
+	if err := cursor.All(ctx, &purchases); err != nil {
+		return nil, fmt.Errorf("failed to decode purchases: %w", err)
+	}
+	return purchases, nil
+}
+
+// ExpirePurchase marks the role of the temprole purchase as removed
+func (ms *MongoStore) ExpirePurchase(ctx context.Context, purchaseID string) error {
+	_, err := ms.purchases().UpdateByID(ctx, purchaseID, bson.M{"$set": bson.M{"expired": true}})
+	if err != nil {
+		return fmt.Errorf("failed to expire purchase: %w", err)
+	}
+	return nil
+}
+
+// MarkDrawn marks the raffle tickets as drawn, so that they don't take part in the next draw
+func (ms *MongoStore) MarkDrawn(ctx context.Context, purchaseIDs []string) error {
+	_, err := ms.purchases().UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": purchaseIDs}},
+		bson.M{"$set": bson.M{"drawn": true}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark raffle tickets drawn: %w", err)
+	}
+	return nil
+}
+
+// SetBackground sets the rank card background of the user, or returns ErrNotFound
+func (ms *MongoStore) SetBackground(ctx context.Context, userID, background string) error {
+	result, err := ms.users().UpdateByID(ctx, userID, bson.M{"$set": bson.M{"background": background}})
+	if err != nil {
+		return fmt.Errorf("failed to update user background: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// activeUsers returns the query matching the users who are still members of the guild
+func activeUsers() bson.M {
+	return bson.M{"leftAt": bson.M{"$exists": false}}
+}
+
+// activityQuery builds the MongoDB query for the activity filter
+func activityQuery(filter ActivityFilter) bson.M {
+	query := bson.M{}
+	if filter.User != "" {
+		query["user"] = filter.User
+	}
+	if filter.Activity != "" {
+		query["activity"] = filter.Activity
+	}
+	if filter.MessageID != "" {
+		query["messageId"] = filter.MessageID
+	}
+	if filter.Emoji != "" {
+		query["emoji"] = filter.Emoji
+	}
+	if filter.FromUser != "" {
+		query["fromUser"] = filter.FromUser
+	}
+	if filter.Key != "" {
+		query["key"] = filter.Key
+	}
+	if !filter.Since.IsZero() {
+		query["createdAt"] = bson.M{"$gte": filter.Since}
+	}
+	return query
+}
+
+// purchaseQuery builds the MongoDB query for the purchase filter
+func purchaseQuery(filter PurchaseFilter) bson.M {
+	query := bson.M{}
+	if filter.User != "" {
+		query["user"] = filter.User
+	}
+	if filter.Item != "" {
+		query["item"] = filter.Item
+	}
+	if filter.Active || !filter.ExpiresBefore.IsZero() {
+		query["kind"] = ShopTempRole
+		query["expired"] = false
+	}
+	if !filter.ExpiresBefore.IsZero() {
+		query["expiresAt"] = bson.M{"$lt": filter.ExpiresBefore}
+	}
+	if filter.Undrawn {
+		query["kind"] = ShopRaffle
+		query["drawn"] = bson.M{"$ne": true}
+	}
+	return query
+}
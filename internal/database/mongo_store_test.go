@@ -0,0 +1,95 @@
+//go:build integration
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/pkg/config"
+)
+
+// The tests of this file run against the MongoDB of MONGO_TEST_URI, each on a database of its own:
+//
+//	MONGO_TEST_URI=mongodb://localhost:27017 go test -tags integration ./internal/database
+
+// newTestMongoStore returns a store on a new database with the migrations applied,
+// which is dropped when the test ends
+func newTestMongoStore(tb testing.TB) *MongoStore {
+	tb.Helper()
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		tb.Skip("MONGO_TEST_URI is not set")
+	}
+
+	dbName := fmt.Sprintf("dappbot_test_%d", time.Now().UnixNano())
+	client, err := GetMongoClient(uri, dbName, 10*time.Second)
+	if err != nil {
+		tb.Fatalf("GetMongoClient: %v", err)
+	}
+	ms := NewMongoStore(client, &config.Config{MongoDBName: dbName})
+	tb.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := client.Database(dbName).Drop(ctx); err != nil {
+			tb.Errorf("drop test database: %v", err)
+		}
+		client.Disconnect(ctx)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := ms.Migrate(ctx, false); err != nil {
+		tb.Fatalf("Migrate: %v", err)
+	}
+	return ms
+}
+
+// seedMongoUsers inserts the users as they are, so that tests choose their points and
+// when they were updated
+func seedMongoUsers(tb testing.TB, ms *MongoStore, users []User) {
+	tb.Helper()
+	docs := make([]interface{}, len(users))
+	for i := range users {
+		docs[i] = users[i]
+	}
+	if _, err := ms.users().InsertMany(context.Background(), docs); err != nil {
+		tb.Fatalf("insert users: %v", err)
+	}
+}
+
+func TestMongoStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return newTestMongoStore(t) })
+}
+
+func TestMongoUserRankTies(t *testing.T) {
+	ms := newTestMongoStore(t)
+	seedMongoUsers(t, ms, rankTieUsers())
+	testRankTies(t, ms)
+}
+
+func BenchmarkMongoUserRank(b *testing.B) {
+	ms := newTestMongoStore(b)
+	start := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	const count = 10000
+	users := make([]User, count)
+	for i := range users {
+		users[i] = User{
+			ID:        fmt.Sprintf("u%d", i),
+			Points:    i % 500,
+			UpdatedAt: start.Add(time.Duration(i%37) * time.Minute),
+		}
+	}
+	seedMongoUsers(b, ms, users)
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ms.UserRank(ctx, fmt.Sprintf("u%d", i%count)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PurgeLeftUsers deletes the users who left the guild before the given time together
+// with their activities, and returns the number of users deleted.
+func PurgeLeftUsers(ctx context.Context, store Store, before time.Time) (int, error) {
+	users, err := store.LeftUsers(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		// Delete the activities first, so that a failure leaves the user to be purged next time
+		if err := store.DeleteActivities(ctx, user.ID); err != nil {
+			return purged, fmt.Errorf("failed to purge activities of user %s: %w", user.ID, err)
+		}
+		if err := store.DeleteUser(ctx, user.ID); err != nil {
+			return purged, fmt.Errorf("failed to purge user %s: %w", user.ID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
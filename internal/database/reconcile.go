@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Discrepancy represents a user whose points do not add up to the rewards of their activities
+type Discrepancy struct {
+	UserID        string
+	Points        int  // points stored on the user
+	ActivityTotal int  // sum of the rewards of the user's activities
+	MissingUser   bool // the user has activities but no user document
+	Repaired      bool
+}
+
+// ReconcileReport represents the result of comparing the points of users with their activities
+type ReconcileReport struct {
+	Checked       int
+	Discrepancies []Discrepancy
+	Repaired      int
+}
+
+// Reconcile compares the points of every user with the sum of their activity rewards.
+// When repair is set, the points of existing users are rebuilt from their activities.
+func Reconcile(ctx context.Context, store Store, repair bool) (*ReconcileReport, error) {
+	points, err := store.UserPoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := store.ActivityTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{}
+	for userID, userPoints := range points {
+		report.Checked++
+		if total := totals[userID]; total != userPoints {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				UserID:        userID,
+				Points:        userPoints,
+				ActivityTotal: total,
+			})
+		}
+	}
+	for userID, total := range totals {
+		if _, ok := points[userID]; !ok {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				UserID:        userID,
+				ActivityTotal: total,
+				MissingUser:   true,
+			})
+		}
+	}
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		return report.Discrepancies[i].UserID < report.Discrepancies[j].UserID
+	})
+
+	if !repair {
+		return report, nil
+	}
+	for i := range report.Discrepancies {
+		d := &report.Discrepancies[i]
+		if d.MissingUser {
+			continue
+		}
+		err := store.SetPoints(ctx, d.UserID, d.Points, d.ActivityTotal)
+		if err == ErrNotFound {
+			// The user was deleted or earned points since they were read, check again later
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to repair points of user %s: %w", d.UserID, err)
+		}
+		d.Repaired = true
+		report.Repaired++
+	}
+	return report, nil
+}
+
+// String describes the discrepancy in one line
+func (d Discrepancy) String() string {
+	if d.MissingUser {
+		return fmt.Sprintf("%s: no user document, activities total %d", d.UserID, d.ActivityTotal)
+	}
+	line := fmt.Sprintf("%s: points %d, activities total %d (%+d)", d.UserID, d.Points, d.ActivityTotal, d.ActivityTotal-d.Points)
+	if d.Repaired {
+		line += " repaired"
+	}
+	return line
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested document does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyExists is returned when a document with the same ID already exists
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrAlreadyCheckedIn is returned when the user already checked in for the day
+	ErrAlreadyCheckedIn = errors.New("already checked in")
+	// ErrDuplicateActivity is returned when an activity with the same key was already applied
+	ErrDuplicateActivity = errors.New("duplicate activity")
+	// ErrInsufficientPoints is returned when the user does not have the points an activity costs
+	ErrInsufficientPoints = errors.New("insufficient points")
+	// ErrOutOfStock is returned when a shop item has no stock left
+	ErrOutOfStock = errors.New("out of stock")
+	// ErrPointsChanged is returned when the points of the user are no longer the ones expected
+	ErrPointsChanged = errors.New("points changed")
+)
+
+// Store represents the storage of users and their activities
+type Store interface {
+	// GetUser returns the user with the given ID, or ErrNotFound
+	GetUser(ctx context.Context, userID string) (*User, error)
+	// CreateUser inserts a new user
+	CreateUser(ctx context.Context, user *User) error
+	// DeleteUser deletes the user with the given ID
+	DeleteUser(ctx context.Context, userID string) error
+	// CheckIn records the daily attendance and streak of the user, or returns ErrAlreadyCheckedIn.
+	// It does not change the points of the user, which are given through ApplyActivity.
+	CheckIn(ctx context.Context, checkIn *CheckIn) (*User, error)
+	// ListUsers returns every user, including the users who left
+	ListUsers(ctx context.Context) ([]User, error)
+	// UpdateMember updates the name and the date the user joined the guild, or returns ErrNotFound
+	UpdateMember(ctx context.Context, userID, userName string, joinedDate time.Time) error
+	// Leaderboard returns a page of the active users ranked by the points they earned since the
+	// given time, or by their total points when since is zero, and the number of ranked users.
+	// Ties go to the user whose points changed first.
+	Leaderboard(ctx context.Context, since time.Time, skip, limit int) ([]LeaderboardEntry, int, error)
+	// LeaderboardPosition returns the rank and the entry of the user on the leaderboard,
+	// or a rank of 0 when the user is not ranked
+	LeaderboardPosition(ctx context.Context, since time.Time, userID string) (int, *LeaderboardEntry, error)
+	// MarkLeft marks the user as having left the guild at the given time, or returns ErrNotFound
+	MarkLeft(ctx context.Context, userID string, at time.Time) error
+	// RestoreUser marks the user as a member of the guild again, or returns ErrNotFound
+	RestoreUser(ctx context.Context, userID, userName string) error
+	// LeftUsers returns the users who left the guild before the given time
+	LeftUsers(ctx context.Context, before time.Time) ([]User, error)
+	// TopUsers returns the active users with the most points, at most limit or all when 0.
+	// Ties go to the earliest updated, in the same order as the leaderboard of all time.
+	TopUsers(ctx context.Context, limit int) ([]User, error)
+	// UserRank returns the ranking of the user by points and the number of ranked users.
+	// The rank is 0 when the user is not ranked, and users who left are not ranked.
+	UserRank(ctx context.Context, userID string) (rank int, total int, err error)
+
+	// ApplyActivity records the activity and adds its reward to the points of the user,
+	// creating the user when it does not exist yet. Both happen or neither does, and an
+	// activity whose key was already applied returns ErrDuplicateActivity. Activities without
+	// a reward leave an existing user unchanged, so they don't reorder ties on the rankings.
+	ApplyActivity(ctx context.Context, activity *Activity) (*User, error)
+	// ApplyDebit records the activity, whose reward is negative, and takes its cost from the
+	// points of the user only when they have at least that many points. Otherwise nothing
+	// changes and it returns ErrInsufficientPoints.
+	ApplyDebit(ctx context.Context, activity *Activity) (*User, error)
+	// ApplyAdjust records the activity and adds its reward to the points of the user only when
+	// they still have current points, creating the user when current is 0. Otherwise nothing
+	// changes and it returns ErrPointsChanged, so the points are set to exactly current+reward.
+	ApplyAdjust(ctx context.Context, activity *Activity, current int) (*User, error)
+	// RevertActivity deletes one activity matching the filter and takes its reward back
+	// from the user. It returns the deleted activity, or ErrNotFound. A reward is only taken
+	// back when the user still has that many points, otherwise nothing changes and it returns
+	// ErrInsufficientPoints, so a user who spent their points never goes below zero.
+	RevertActivity(ctx context.Context, filter ActivityFilter) (*Activity, *User, error)
+	// CountActivities returns the number of activities matching the filter
+	CountActivities(ctx context.Context, filter ActivityFilter) (int, error)
+	// SumActivities returns the sum of the rewards of the activities matching the filter
+	SumActivities(ctx context.Context, filter ActivityFilter) (int, error)
+	// ListActivities returns the activities matching the filter, newest first,
+	// skipping the first skip activities and returning at most limit, or all when 0
+	ListActivities(ctx context.Context, filter ActivityFilter, skip, limit int) ([]Activity, error)
+	// DeleteActivities deletes every activity of the user
+	DeleteActivities(ctx context.Context, userID string) error
+
+	// UserPoints returns the points of every user by user ID
+	UserPoints(ctx context.Context) (map[string]int, error)
+	// ActivityTotals returns the sum of the activity rewards of every user by user ID
+	ActivityTotals(ctx context.Context) (map[string]int, error)
+	// InsertAudit records the audit entries
+	InsertAudit(ctx context.Context, entries []AuditEntry) error
+
+	// ListBlockedReactions returns every blocked reaction
+	ListBlockedReactions(ctx context.Context) ([]BlockedReaction, error)
+	// AddBlockedReaction blocks the emoji, or returns ErrAlreadyExists
+	AddBlockedReaction(ctx context.Context, blocked *BlockedReaction) error
+	// RemoveBlockedReaction unblocks the emoji in the channel, or returns ErrNotFound
+	RemoveBlockedReaction(ctx context.Context, emoji, channelID string) error
+
+	// ListShopItems returns every item of the shop, cheapest first
+	ListShopItems(ctx context.Context) ([]ShopItem, error)
+	// GetShopItem returns the item with the given ID, or ErrNotFound
+	GetShopItem(ctx context.Context, itemID string) (*ShopItem, error)
+	// AddShopItem puts the item up for sale, or returns ErrAlreadyExists
+	AddShopItem(ctx context.Context, item *ShopItem) error
+	// RemoveShopItem takes the item off sale, or returns ErrNotFound
+	RemoveShopItem(ctx context.Context, itemID string) error
+	// SetShopStock sets the items left, -1 for unlimited, or returns ErrNotFound
+	SetShopStock(ctx context.Context, itemID string, stock int) error
+	// TakeShopStock takes one item from its stock and returns the item. It returns ErrOutOfStock
+	// when none is left, so concurrent purchases never sell more items than the stock.
+	TakeShopStock(ctx context.Context, itemID string) (*ShopItem, error)
+	// ReturnShopStock puts an item taken with TakeShopStock back into its stock
+	ReturnShopStock(ctx context.Context, itemID string) error
+	// InsertPurchase records the purchase
+	InsertPurchase(ctx context.Context, purchase *Purchase) error
+	// DeletePurchase deletes the purchase with the given ID, for refunds
+	DeletePurchase(ctx context.Context, purchaseID string) error
+	// ListPurchases returns the purchases matching the filter, newest first, at most limit or all when 0
+	ListPurchases(ctx context.Context, filter PurchaseFilter, limit int) ([]Purchase, error)
+	// ExpirePurchase marks the role of the temprole purchase as removed
+	ExpirePurchase(ctx context.Context, purchaseID string) error
+	// MarkDrawn marks the raffle tickets as drawn, so that they don't take part in the next draw
+	MarkDrawn(ctx context.Context, purchaseIDs []string) error
+	// SetBackground sets the rank card background of the user, or returns ErrNotFound
+	SetBackground(ctx context.Context, userID, background string) error
+
+	// SetPoints overwrites the points of the user when they still equal current,
+	// or returns ErrNotFound when the user does not exist or the points changed
+	SetPoints(ctx context.Context, userID string, current, points int) error
+}
+
+// LeaderboardEntry represents the points of a user on a leaderboard
+type LeaderboardEntry struct {
+	UserID    string    `bson:"_id"`
+	UserName  string    `bson:"userName"`
+	Points    int       `bson:"points"`
+	UpdatedAt time.Time `bson:"updatedAt"` // when the points last changed, used to break ties
+}
+
+// ranksBefore reports whether the entry ranks before the other one
+func (e *LeaderboardEntry) ranksBefore(other *LeaderboardEntry) bool {
+	if e.Points != other.Points {
+		return e.Points > other.Points
+	}
+	if !e.UpdatedAt.Equal(other.UpdatedAt) {
+		return e.UpdatedAt.Before(other.UpdatedAt)
+	}
+	return e.UserID < other.UserID
+}
+
+// CheckIn represents the changes made to a user when checking in for the daily attendance
+type CheckIn struct {
+	UserID        string
+	UserName      string
+	JoinedDate    time.Time // used when the user does not exist yet
+	Since         time.Time // the user must not have checked in since this time
+	At            time.Time
+	CurrentStreak int
+	LongestStreak int
+	StreakFreezes int // change to the number of streak freezes
+}
+
+// ActivityFilter represents the conditions to match activities, empty fields match anything
+type ActivityFilter struct {
+	User      string
+	Activity  string
+	MessageID string
+	Emoji     string
+	FromUser  string
+	Key       string
+	Since     time.Time
+}
+
+// matches reports whether the activity matches the filter
+func (f ActivityFilter) matches(a *Activity) bool {
+	return (f.User == "" || f.User == a.User) &&
+		(f.Activity == "" || f.Activity == a.Activity) &&
+		(f.MessageID == "" || f.MessageID == a.MessageId) &&
+		(f.Emoji == "" || f.Emoji == a.Emoji) &&
+		(f.FromUser == "" || f.FromUser == a.FromUser) &&
+		(f.Key == "" || f.Key == a.Key) &&
+		(f.Since.IsZero() || !a.CreatedAt.Before(f.Since))
+}
+
+// PurchaseFilter represents the conditions to match purchases, empty fields match anything
+type PurchaseFilter struct {
+	User          string
+	Item          string
+	Active        bool      // only temproles whose role was not removed yet
+	Undrawn       bool      // only raffle tickets which did not take part in a draw yet
+	ExpiresBefore time.Time // only temproles whose role was not removed yet and expires before this time
+}
+
+// matches reports whether the purchase matches the filter
+func (f PurchaseFilter) matches(p *Purchase) bool {
+	active := p.Kind == ShopTempRole && !p.Expired
+	return (f.User == "" || f.User == p.User) &&
+		(f.Item == "" || f.Item == p.Item) &&
+		(!f.Active || active) &&
+		(!f.Undrawn || (p.Kind == ShopRaffle && !p.Drawn)) &&
+		(f.ExpiresBefore.IsZero() || (active && p.ExpiresAt.Before(f.ExpiresBefore)))
+}
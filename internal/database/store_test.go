@@ -0,0 +1,479 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return NewMemoryStore() })
+}
+
+// testStore runs the contract every Store implementation must follow against fresh stores
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{"ApplyActivity", testApplyActivity},
+		{"ApplyDebit", testApplyDebit},
+		{"ApplyAdjust", testApplyAdjust},
+		{"RevertActivity", testRevertActivity},
+		{"RevertSpentActivity", testRevertSpentActivity},
+		{"QueryActivities", testQueryActivities},
+		{"TopUsers", testTopUsers},
+		{"CheckIn", testCheckIn},
+		{"BlockedReactions", testBlockedReactions},
+		{"ShopStock", testShopStock},
+		{"Purchases", testPurchases},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// testTime is the time the activities of the tests are created at
+var testTime = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// testActivity returns an activity of the user with the reward and key
+func testActivity(userID, activity string, reward int, key string, at time.Time) *Activity {
+	return &Activity{
+		User:      userID,
+		UserName:  "name-" + userID,
+		Activity:  activity,
+		Reward:    reward,
+		Key:       key,
+		CreatedAt: at,
+		UpdatedAt: at,
+	}
+}
+
+// mustApply applies the activity, failing the test on an error
+func mustApply(t *testing.T, store Store, activity *Activity) *User {
+	t.Helper()
+	user, err := store.ApplyActivity(context.Background(), activity)
+	if err != nil {
+		t.Fatalf("ApplyActivity(%s): %v", activity.Key, err)
+	}
+	return user
+}
+
+// wantPoints fails the test when the user does not have the points
+func wantPoints(t *testing.T, store Store, userID string, points int) {
+	t.Helper()
+	user, err := store.GetUser(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetUser(%s): %v", userID, err)
+	}
+	if user.Points != points {
+		t.Errorf("points of %s = %d, want %d", userID, user.Points, points)
+	}
+}
+
+func testApplyActivity(t *testing.T, store Store) {
+	ctx := context.Background()
+	if _, err := store.GetUser(ctx, "u1"); err != ErrNotFound {
+		t.Fatalf("GetUser of a new user error = %v, want %v", err, ErrNotFound)
+	}
+
+	user := mustApply(t, store, testActivity("u1", ActivityAttend, 10, "attend:u1", testTime))
+	if user.ID != "u1" || user.Points != 10 {
+		t.Errorf("ApplyActivity() = %s with %d points, want u1 with 10", user.ID, user.Points)
+	}
+	mustApply(t, store, testActivity("u1", ActivityReact, 5, "react:u1", testTime))
+	wantPoints(t, store, "u1", 15)
+
+	_, err := store.ApplyActivity(ctx, testActivity("u1", ActivityAttend, 10, "attend:u1", testTime))
+	if err != ErrDuplicateActivity {
+		t.Errorf("applying a key twice error = %v, want %v", err, ErrDuplicateActivity)
+	}
+	wantPoints(t, store, "u1", 15)
+
+	// Activities without a reward leave the user as it was
+	before, err := store.GetUser(ctx, "u1")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	mustApply(t, store, testActivity("u1", ActivityPlay, 0, "play:u1", testTime))
+	after, err := store.GetUser(ctx, "u1")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if after.Points != before.Points || !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("activity without a reward changed the user from %d points at %s to %d at %s",
+			before.Points, before.UpdatedAt, after.Points, after.UpdatedAt)
+	}
+}
+
+func testApplyDebit(t *testing.T, store Store) {
+	ctx := context.Background()
+	if _, err := store.ApplyDebit(ctx, testActivity("u1", ActivityWager, -10, "wager:0", testTime)); err != ErrInsufficientPoints {
+		t.Errorf("debit of a new user error = %v, want %v", err, ErrInsufficientPoints)
+	}
+
+	mustApply(t, store, testActivity("u1", ActivityAdjust, 50, "adjust:u1", testTime))
+	if _, err := store.ApplyDebit(ctx, testActivity("u1", ActivityWager, -60, "wager:1", testTime)); err != ErrInsufficientPoints {
+		t.Errorf("debit above the points error = %v, want %v", err, ErrInsufficientPoints)
+	}
+	wantPoints(t, store, "u1", 50)
+
+	user, err := store.ApplyDebit(ctx, testActivity("u1", ActivityWager, -50, "wager:2", testTime))
+	if err != nil {
+		t.Fatalf("debit of every point: %v", err)
+	}
+	if user.Points != 0 {
+		t.Errorf("ApplyDebit() points = %d, want 0", user.Points)
+	}
+	if _, err := store.ApplyDebit(ctx, testActivity("u1", ActivityWager, -50, "wager:2", testTime)); err != ErrDuplicateActivity {
+		t.Errorf("debit of a key twice error = %v, want %v", err, ErrDuplicateActivity)
+	}
+	if _, err := store.ApplyDebit(ctx, testActivity("u1", ActivityWager, 10, "wager:3", testTime)); err == nil {
+		t.Error("debit with a positive reward succeeded")
+	}
+	wantPoints(t, store, "u1", 0)
+
+	// The failed debits were not recorded
+	count, err := store.CountActivities(ctx, ActivityFilter{User: "u1", Activity: ActivityWager})
+	if err != nil {
+		t.Fatalf("CountActivities: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("wager activities = %d, want 1", count)
+	}
+}
+
+func testApplyAdjust(t *testing.T, store Store) {
+	ctx := context.Background()
+	if _, err := store.ApplyAdjust(ctx, testActivity("u1", ActivityAdjust, 30, "adjust:0", testTime), 10); err != ErrPointsChanged {
+		t.Errorf("adjusting a new user from 10 error = %v, want %v", err, ErrPointsChanged)
+	}
+	user, err := store.ApplyAdjust(ctx, testActivity("u1", ActivityAdjust, 30, "adjust:1", testTime), 0)
+	if err != nil {
+		t.Fatalf("adjusting a new user from 0: %v", err)
+	}
+	if user.Points != 30 {
+		t.Errorf("ApplyAdjust() points = %d, want 30", user.Points)
+	}
+
+	// The points changed since they were read, so the set is not applied
+	mustApply(t, store, testActivity("u1", ActivityReact, 5, "react:u1", testTime))
+	if _, err := store.ApplyAdjust(ctx, testActivity("u1", ActivityAdjust, -20, "adjust:2", testTime), 30); err != ErrPointsChanged {
+		t.Errorf("adjusting changed points error = %v, want %v", err, ErrPointsChanged)
+	}
+	wantPoints(t, store, "u1", 35)
+
+	// The same key can be applied once the points are read again
+	user, err = store.ApplyAdjust(ctx, testActivity("u1", ActivityAdjust, -25, "adjust:2", testTime), 35)
+	if err != nil {
+		t.Fatalf("adjusting after reading the points again: %v", err)
+	}
+	if user.Points != 10 {
+		t.Errorf("ApplyAdjust() points = %d, want 10", user.Points)
+	}
+	if _, err := store.ApplyAdjust(ctx, testActivity("u1", ActivityAdjust, -25, "adjust:2", testTime), 10); err != ErrDuplicateActivity {
+		t.Errorf("adjusting a key twice error = %v, want %v", err, ErrDuplicateActivity)
+	}
+	sum, err := store.SumActivities(ctx, ActivityFilter{User: "u1"})
+	if err != nil || sum != 10 {
+		t.Errorf("SumActivities() = %d, %v, want the 10 points of the user", sum, err)
+	}
+}
+
+func testRevertActivity(t *testing.T, store Store) {
+	ctx := context.Background()
+	mustApply(t, store, testActivity("u1", ActivityAttend, 10, "attend:u1", testTime))
+	mustApply(t, store, testActivity("u1", ActivityReact, 5, "react:u1", testTime))
+
+	activity, user, err := store.RevertActivity(ctx, ActivityFilter{Key: "attend:u1"})
+	if err != nil {
+		t.Fatalf("RevertActivity: %v", err)
+	}
+	if activity.Key != "attend:u1" || user.Points != 5 {
+		t.Errorf("RevertActivity() = %s and %d points, want attend:u1 and 5", activity.Key, user.Points)
+	}
+	if _, _, err := store.RevertActivity(ctx, ActivityFilter{Key: "attend:u1"}); err != ErrNotFound {
+		t.Errorf("reverting twice error = %v, want %v", err, ErrNotFound)
+	}
+
+	// A reverted key can be applied again
+	mustApply(t, store, testActivity("u1", ActivityAttend, 10, "attend:u1", testTime))
+	wantPoints(t, store, "u1", 15)
+}
+
+func testRevertSpentActivity(t *testing.T, store Store) {
+	ctx := context.Background()
+	mustApply(t, store, testActivity("u1", ActivityReact, 10, "react:u1", testTime))
+	if _, err := store.ApplyDebit(ctx, testActivity("u1", ActivityPurchase, -8, "purchase:u1", testTime)); err != nil {
+		t.Fatalf("ApplyDebit: %v", err)
+	}
+
+	// The reward was spent, so it is kept rather than taking the user below zero
+	if _, _, err := store.RevertActivity(ctx, ActivityFilter{Key: "react:u1"}); err != ErrInsufficientPoints {
+		t.Fatalf("reverting a spent reward error = %v, want %v", err, ErrInsufficientPoints)
+	}
+	wantPoints(t, store, "u1", 2)
+	count, err := store.CountActivities(ctx, ActivityFilter{Key: "react:u1"})
+	if err != nil || count != 1 {
+		t.Errorf("CountActivities() of the kept reward = %d, %v, want 1", count, err)
+	}
+
+	// Reverting a debit gives its cost back whatever the points are
+	_, user, err := store.RevertActivity(ctx, ActivityFilter{Key: "purchase:u1"})
+	if err != nil {
+		t.Fatalf("reverting a debit: %v", err)
+	}
+	if user.Points != 10 {
+		t.Errorf("points after reverting a debit = %d, want 10", user.Points)
+	}
+	if _, _, err := store.RevertActivity(ctx, ActivityFilter{Key: "react:u1"}); err != nil {
+		t.Errorf("reverting once the points are back: %v", err)
+	}
+	wantPoints(t, store, "u1", 0)
+}
+
+func testQueryActivities(t *testing.T, store Store) {
+	ctx := context.Background()
+	for i, key := range []string{"a", "b", "c", "d"} {
+		mustApply(t, store, testActivity("u1", ActivityReact, i+1, key, testTime.Add(time.Duration(i)*time.Hour)))
+	}
+	mustApply(t, store, testActivity("u2", ActivityReact, 100, "e", testTime))
+	mustApply(t, store, testActivity("u1", ActivityAttend, 10, "f", testTime))
+
+	filter := ActivityFilter{User: "u1", Activity: ActivityReact}
+	count, err := store.CountActivities(ctx, filter)
+	if err != nil || count != 4 {
+		t.Errorf("CountActivities() = %d, %v, want 4", count, err)
+	}
+	sum, err := store.SumActivities(ctx, filter)
+	if err != nil || sum != 10 {
+		t.Errorf("SumActivities() = %d, %v, want 10", sum, err)
+	}
+	since := ActivityFilter{User: "u1", Activity: ActivityReact, Since: testTime.Add(2 * time.Hour)}
+	sum, err = store.SumActivities(ctx, since)
+	if err != nil || sum != 7 {
+		t.Errorf("SumActivities() since = %d, %v, want 7", sum, err)
+	}
+
+	tests := []struct {
+		name  string
+		skip  int
+		limit int
+		keys  []string
+	}{
+		{name: "first page", skip: 0, limit: 2, keys: []string{"d", "c"}},
+		{name: "second page", skip: 2, limit: 2, keys: []string{"b", "a"}},
+		{name: "past the end", skip: 4, limit: 2, keys: nil},
+		{name: "no limit", skip: 0, limit: 0, keys: []string{"d", "c", "b", "a"}},
+		{name: "no limit skipped", skip: 1, limit: 0, keys: []string{"c", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activities, err := store.ListActivities(ctx, filter, tt.skip, tt.limit)
+			if err != nil {
+				t.Fatalf("ListActivities: %v", err)
+			}
+			if len(activities) != len(tt.keys) {
+				t.Fatalf("ListActivities() returned %d activities, want %d", len(activities), len(tt.keys))
+			}
+			for i, key := range tt.keys {
+				if activities[i].Key != key {
+					t.Errorf("activity %d = %s, want %s", i, activities[i].Key, key)
+				}
+			}
+		})
+	}
+}
+
+func testTopUsers(t *testing.T, store Store) {
+	ctx := context.Background()
+	for i, userID := range []string{"u1", "u2", "u3"} {
+		mustApply(t, store, testActivity(userID, ActivityAdjust, (i+1)*10, "adjust:"+userID, testTime))
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		ids   []string
+	}{
+		{name: "limited", limit: 2, ids: []string{"u3", "u2"}},
+		{name: "above the users", limit: 10, ids: []string{"u3", "u2", "u1"}},
+		{name: "no limit", limit: 0, ids: []string{"u3", "u2", "u1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := store.TopUsers(ctx, tt.limit)
+			if err != nil {
+				t.Fatalf("TopUsers: %v", err)
+			}
+			if len(users) != len(tt.ids) {
+				t.Fatalf("TopUsers() returned %d users, want %d", len(users), len(tt.ids))
+			}
+			for i, id := range tt.ids {
+				if users[i].ID != id {
+					t.Errorf("user %d = %s, want %s", i, users[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func testCheckIn(t *testing.T, store Store) {
+	ctx := context.Background()
+	today := testTime.Truncate(24 * time.Hour)
+	checkIn := &CheckIn{
+		UserID:        "u1",
+		UserName:      "alice",
+		JoinedDate:    testTime,
+		Since:         today,
+		At:            testTime,
+		CurrentStreak: 3,
+		LongestStreak: 5,
+		StreakFreezes: 1,
+	}
+	user, err := store.CheckIn(ctx, checkIn)
+	if err != nil {
+		t.Fatalf("CheckIn: %v", err)
+	}
+	if user.CurrentStreak != 3 || user.LongestStreak != 5 || user.StreakFreezes != 1 || !user.LastAttendance.Equal(testTime) {
+		t.Errorf("CheckIn() = %+v, want the streaks of the check-in", user)
+	}
+	if _, err := store.CheckIn(ctx, checkIn); err != ErrAlreadyCheckedIn {
+		t.Errorf("checking in twice error = %v, want %v", err, ErrAlreadyCheckedIn)
+	}
+
+	// Streak freezes are added to the ones the user has
+	tomorrow := *checkIn
+	tomorrow.Since = today.AddDate(0, 0, 1)
+	tomorrow.At = testTime.AddDate(0, 0, 1)
+	tomorrow.CurrentStreak = 4
+	tomorrow.StreakFreezes = -1
+	user, err = store.CheckIn(ctx, &tomorrow)
+	if err != nil {
+		t.Fatalf("CheckIn the next day: %v", err)
+	}
+	if user.CurrentStreak != 4 || user.StreakFreezes != 0 {
+		t.Errorf("CheckIn() the next day = streak %d and %d freezes, want 4 and 0", user.CurrentStreak, user.StreakFreezes)
+	}
+}
+
+func testBlockedReactions(t *testing.T, store Store) {
+	ctx := context.Background()
+	blocked := &BlockedReaction{Emoji: "💩", ChannelID: "c1", AddedBy: "admin", CreatedAt: testTime}
+	if err := store.AddBlockedReaction(ctx, blocked); err != nil {
+		t.Fatalf("AddBlockedReaction: %v", err)
+	}
+	if err := store.AddBlockedReaction(ctx, blocked); err != ErrAlreadyExists {
+		t.Errorf("blocking twice error = %v, want %v", err, ErrAlreadyExists)
+	}
+	everywhere := &BlockedReaction{Emoji: "💩", AddedBy: "admin", CreatedAt: testTime}
+	if err := store.AddBlockedReaction(ctx, everywhere); err != nil {
+		t.Errorf("blocking in every channel: %v", err)
+	}
+
+	list, err := store.ListBlockedReactions(ctx)
+	if err != nil || len(list) != 2 {
+		t.Errorf("ListBlockedReactions() = %d reactions, %v, want 2", len(list), err)
+	}
+	if err := store.RemoveBlockedReaction(ctx, "💩", "c1"); err != nil {
+		t.Errorf("RemoveBlockedReaction: %v", err)
+	}
+	if err := store.RemoveBlockedReaction(ctx, "💩", "c1"); err != ErrNotFound {
+		t.Errorf("unblocking twice error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func testShopStock(t *testing.T, store Store) {
+	ctx := context.Background()
+	if _, err := store.TakeShopStock(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("TakeShopStock of a missing item error = %v, want %v", err, ErrNotFound)
+	}
+	items := []*ShopItem{
+		{ID: "vip", Name: "VIP", Kind: ShopRole, Price: 500, Stock: 1, CreatedAt: testTime},
+		{ID: "ticket", Name: "Ticket", Kind: ShopRaffle, Price: 50, Stock: -1, CreatedAt: testTime},
+	}
+	for _, item := range items {
+		if err := store.AddShopItem(ctx, item); err != nil {
+			t.Fatalf("AddShopItem(%s): %v", item.ID, err)
+		}
+	}
+	if err := store.AddShopItem(ctx, items[0]); err != ErrAlreadyExists {
+		t.Errorf("adding an item twice error = %v, want %v", err, ErrAlreadyExists)
+	}
+	list, err := store.ListShopItems(ctx)
+	if err != nil || len(list) != 2 || list[0].ID != "ticket" {
+		t.Errorf("ListShopItems() = %+v, %v, want the cheapest first", list, err)
+	}
+
+	if _, err := store.TakeShopStock(ctx, "vip"); err != nil {
+		t.Fatalf("TakeShopStock: %v", err)
+	}
+	if _, err := store.TakeShopStock(ctx, "vip"); err != ErrOutOfStock {
+		t.Errorf("taking the last item twice error = %v, want %v", err, ErrOutOfStock)
+	}
+	if err := store.ReturnShopStock(ctx, "vip"); err != nil {
+		t.Fatalf("ReturnShopStock: %v", err)
+	}
+	if item, err := store.TakeShopStock(ctx, "vip"); err != nil || item.Stock != 0 {
+		t.Errorf("TakeShopStock() after a return = %+v, %v, want a stock of 0", item, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if item, err := store.TakeShopStock(ctx, "ticket"); err != nil || !item.Unlimited() {
+			t.Errorf("TakeShopStock() of an unlimited item = %+v, %v", item, err)
+		}
+	}
+}
+
+func testPurchases(t *testing.T, store Store) {
+	ctx := context.Background()
+	purchases := []*Purchase{
+		{ID: "p1", User: "u1", Item: "ticket", Kind: ShopRaffle, CreatedAt: testTime},
+		{ID: "p2", User: "u2", Item: "ticket", Kind: ShopRaffle, CreatedAt: testTime.Add(time.Hour)},
+		{ID: "p3", User: "u1", Item: "temp", Kind: ShopTempRole, ExpiresAt: testTime.Add(time.Hour), CreatedAt: testTime.Add(2 * time.Hour)},
+	}
+	for _, purchase := range purchases {
+		if err := store.InsertPurchase(ctx, purchase); err != nil {
+			t.Fatalf("InsertPurchase(%s): %v", purchase.ID, err)
+		}
+	}
+
+	wantPurchases := func(name string, filter PurchaseFilter, limit int, ids ...string) {
+		t.Helper()
+		list, err := store.ListPurchases(ctx, filter, limit)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(list) != len(ids) {
+			t.Fatalf("%s returned %d purchases, want %d", name, len(list), len(ids))
+		}
+		for i, id := range ids {
+			if list[i].ID != id {
+				t.Errorf("%s purchase %d = %s, want %s", name, i, list[i].ID, id)
+			}
+		}
+	}
+	wantPurchases("every purchase", PurchaseFilter{}, 0, "p3", "p2", "p1")
+	wantPurchases("limited", PurchaseFilter{}, 2, "p3", "p2")
+	wantPurchases("by user", PurchaseFilter{User: "u1"}, 0, "p3", "p1")
+	wantPurchases("active temproles", PurchaseFilter{Active: true}, 0, "p3")
+	wantPurchases("expiring", PurchaseFilter{ExpiresBefore: testTime.Add(2 * time.Hour)}, 0, "p3")
+	wantPurchases("undrawn tickets", PurchaseFilter{Item: "ticket", Undrawn: true}, 0, "p2", "p1")
+
+	if err := store.MarkDrawn(ctx, []string{"p1"}); err != nil {
+		t.Fatalf("MarkDrawn: %v", err)
+	}
+	wantPurchases("undrawn tickets after a draw", PurchaseFilter{Item: "ticket", Undrawn: true}, 0, "p2")
+
+	if err := store.ExpirePurchase(ctx, "p3"); err != nil {
+		t.Fatalf("ExpirePurchase: %v", err)
+	}
+	wantPurchases("active temproles after expiring", PurchaseFilter{Active: true}, 0)
+
+	if err := store.DeletePurchase(ctx, "p2"); err != nil {
+		t.Fatalf("DeletePurchase: %v", err)
+	}
+	wantPurchases("after a refund", PurchaseFilter{}, 0, "p3", "p1")
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"time"
+
+	"github.com/augustine0890/dapp-bot/pkg/logging"
 	"github.com/spf13/viper"
 )
 
@@ -11,6 +14,134 @@ type Config struct {
 	DiscordToken string `mapstructure:"discord_token"`
 	GuildID      string `mapstructure:"guild_id"`
 	AttendanceID string `mapstructure:"attendance_id"`
+	Timezone     string `mapstructure:"timezone"`
+	AutoMigrate  bool   `mapstructure:"auto_migrate"` // apply pending database migrations at startup
+
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"` // longest wait for handlers in flight when stopping
+	HTTPAddr        string        `mapstructure:"http_addr"`        // address of the health and metrics endpoints, empty to disable
+
+	OwnerIDs     []string `mapstructure:"owner_ids"`      // user IDs allowed to run every command
+	AdminRoleIDs []string `mapstructure:"admin_role_ids"` // role IDs allowed to run admin commands, empty for administrators
+
+	StreakBonuses []StreakBonus `mapstructure:"streak_bonuses"`
+
+	Reactions ReactionConfig `mapstructure:"reactions"`
+
+	Leveling LevelingConfig `mapstructure:"leveling"`
+
+	Members MemberConfig `mapstructure:"members"`
+
+	Cooldowns map[string]CooldownConfig `mapstructure:"cooldowns"` // by command name
+
+	Audit AuditConfig `mapstructure:"audit"`
+
+	Moderation ModerationConfig `mapstructure:"moderation"`
+
+	Games GamesConfig `mapstructure:"games"`
+
+	Trivia TriviaConfig `mapstructure:"trivia"`
+
+	Wagers WagerConfig `mapstructure:"wagers"`
+
+	Shop ShopConfig `mapstructure:"shop"`
+}
+
+// ShopConfig represents the points shop (!shop and !buy). Its items are added by admins with !shopadmin.
+type ShopConfig struct {
+	Channels       []string      `mapstructure:"channels"`        // empty means every channel
+	ExpiryInterval time.Duration `mapstructure:"expiry_interval"` // how often expired temporary roles are removed
+}
+
+// WagerConfig represents the limits of the point wagering games (!flip and !slots).
+type WagerConfig struct {
+	MinBet         int      `mapstructure:"min_bet"`
+	MaxBet         int      `mapstructure:"max_bet"`
+	DailyLossLimit int      `mapstructure:"daily_loss_limit"` // points a user can lose per day, 0 for no limit
+	Channels       []string `mapstructure:"channels"`         // empty means every channel
+	Seed           int64    `mapstructure:"seed"`             // seed of the RNG, 0 seeds it from the clock
+}
+
+// TriviaConfig represents the trivia games run with !trivia.
+type TriviaConfig struct {
+	BankPath  string        `mapstructure:"bank_path"`  // YAML or JSON file of questions
+	RoundTime time.Duration `mapstructure:"round_time"` // how long each question accepts answers
+	Rounds    int           `mapstructure:"rounds"`     // rounds of a game when none are given
+	MaxRounds int           `mapstructure:"max_rounds"`
+	Points    []int         `mapstructure:"points"`  // round score of the fastest correct answers, in order
+	Rewards   []int         `mapstructure:"rewards"` // points given at the end of a game, by place
+}
+
+// GamesConfig represents the minigames played with !dapp.
+type GamesConfig struct {
+	Reward     int           `mapstructure:"reward"`      // points for winning a game
+	DailyLimit int           `mapstructure:"daily_limit"` // games a user can play per day, 0 for no limit
+	Timeout    time.Duration `mapstructure:"timeout"`     // how long a game waits for the next answer
+}
+
+// ModerationConfig represents how blocked reactions are handled.
+type ModerationConfig struct {
+	BlockedReactions []string      `mapstructure:"blocked_reactions"` // blocked in every channel, on top of the ones added with !blocklist
+	Penalty          int           `mapstructure:"penalty"`           // points taken for each removed reaction, 0 for none
+	Strikes          int           `mapstructure:"strikes"`           // removed reactions within the window before a timeout, 0 for never
+	StrikeWindow     time.Duration `mapstructure:"strike_window"`
+	Timeout          time.Duration `mapstructure:"timeout"` // how long repeat offenders are timed out
+}
+
+// AuditConfig represents where the changes made by the bot are logged.
+type AuditConfig struct {
+	ChannelID     string        `mapstructure:"channel_id"`     // empty to only store the entries
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // longest time entries wait to be posted
+}
+
+// CooldownConfig represents how long a command cannot be used again, 0 for no cooldown.
+type CooldownConfig struct {
+	User    time.Duration `mapstructure:"user"`
+	Channel time.Duration `mapstructure:"channel"`
+	Global  time.Duration `mapstructure:"global"`
+}
+
+// Rejoin policies deciding what happens to the points of a member who rejoins the guild.
+const (
+	RejoinRestore = "restore" // keep the points and activities from before leaving
+	RejoinReset   = "reset"   // start over with no points
+)
+
+// MemberConfig represents how members who leave the guild are handled.
+type MemberConfig struct {
+	RejoinPolicy      string `mapstructure:"rejoin_policy"`       // restore or reset
+	LeftRetentionDays int    `mapstructure:"left_retention_days"` // days before the data of a member who left is deleted, 0 keeps it
+}
+
+// ReactionConfig represents the rules for earning points with reactions.
+type ReactionConfig struct {
+	Channels        []string `mapstructure:"channels"` // empty means every channel
+	Emojis          []string `mapstructure:"emojis"`   // empty means every emoji
+	ReactReward     int      `mapstructure:"react_reward"`
+	ReceiveReward   int      `mapstructure:"receive_reward"`
+	ReactDailyCap   int      `mapstructure:"react_daily_cap"`
+	ReceiveDailyCap int      `mapstructure:"receive_daily_cap"`
+}
+
+// LevelingConfig represents how points are turned into levels.
+type LevelingConfig struct {
+	Curve             string      `mapstructure:"curve"` // linear, quadratic or table
+	Base              int         `mapstructure:"base"`  // points per level (linear) or the factor of level² (quadratic)
+	Table             []int       `mapstructure:"table"` // total points needed for level 1, 2, 3, ...
+	AnnounceChannelID string      `mapstructure:"announce_channel_id"`
+	RoleRewards       []LevelRole `mapstructure:"role_rewards"`
+}
+
+// LevelRole represents a role given to users when they reach a level.
+type LevelRole struct {
+	Level  int    `mapstructure:"level"`
+	RoleID string `mapstructure:"role_id"`
+}
+
+// StreakBonus represents the extra reward given when a user reaches an attendance streak.
+type StreakBonus struct {
+	Days    int `mapstructure:"days"`
+	Reward  int `mapstructure:"reward"`
+	Freezes int `mapstructure:"freezes"` // streak freeze tokens granted with the bonus
 }
 
 // LoadConfig loads the application's configuration from the config file.
@@ -26,6 +157,34 @@ func LoadConfig(stage string) (*Config, error) {
 	viper.AddConfigPath("./pkg/config/")
 	viper.SetDefault("mongo_uri", "mongodb://localhost:27017")
 	viper.SetDefault("discord_token", "my-discord-token")
+	viper.SetDefault("timezone", "UTC")
+	viper.SetDefault("auto_migrate", true)
+	viper.SetDefault("shutdown_timeout", "30s")
+	viper.SetDefault("reactions.react_reward", 5)
+	viper.SetDefault("reactions.receive_reward", 5)
+	viper.SetDefault("reactions.react_daily_cap", 10)
+	viper.SetDefault("reactions.receive_daily_cap", 20)
+	viper.SetDefault("leveling.curve", "quadratic")
+	viper.SetDefault("leveling.base", 50)
+	viper.SetDefault("members.rejoin_policy", RejoinRestore)
+	viper.SetDefault("members.left_retention_days", 90)
+	viper.SetDefault("audit.flush_interval", "5s")
+	viper.SetDefault("moderation.blocked_reactions", []string{"🖕🏻", "🖕", "🖕🏽"})
+	viper.SetDefault("moderation.strike_window", "1h")
+	viper.SetDefault("moderation.timeout", "10m")
+	viper.SetDefault("games.reward", 50)
+	viper.SetDefault("games.daily_limit", 5)
+	viper.SetDefault("games.timeout", "30s")
+	viper.SetDefault("trivia.bank_path", "./pkg/trivia/questions.yaml")
+	viper.SetDefault("trivia.round_time", "20s")
+	viper.SetDefault("trivia.rounds", 5)
+	viper.SetDefault("trivia.max_rounds", 20)
+	viper.SetDefault("trivia.points", []int{3, 2, 1})
+	viper.SetDefault("trivia.rewards", []int{100, 50, 25})
+	viper.SetDefault("wagers.min_bet", 10)
+	viper.SetDefault("wagers.max_bet", 1000)
+	viper.SetDefault("wagers.daily_loss_limit", 2000)
+	viper.SetDefault("shop.expiry_interval", "5m")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
@@ -38,3 +197,14 @@ func LoadConfig(stage string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// Location returns the time zone used to decide calendar days (e.g. for daily attendance).
+// It falls back to UTC when the configured time zone cannot be loaded.
+func (c *Config) Location() *time.Location {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		logging.Warn("Failed to load timezone, falling back to UTC", err)
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,228 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// attendReward is the number of points given for a daily check-in
+const attendReward = 10
+
+// AttendCommand returns a command handler function for the !attend command
+func AttendCommand(cfg *config.Config, store database.Store, ledger *Ledger) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleAttend(s, m, args, cfg, store, ledger)
+	}
+}
+
+// startOfDay returns the beginning of the calendar day of t in the given location
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// handleAttend handles the !attend command, giving the user the daily attendance points once per day
+func handleAttend(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, store database.Store, ledger *Ledger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	loc := cfg.Location()
+	today := startOfDay(now, loc)
+	nextCheckIn := today.AddDate(0, 0, 1)
+
+	// Read the current streak of the user; a missing user is created by the attendance activity
+	current, err := store.GetUser(ctx, m.Author.ID)
+	if err == database.ErrNotFound {
+		current = &database.User{ID: m.Author.ID}
+	} else if err != nil {
+		logging.Error("Failed retrieving user attendance", err)
+		return
+	}
+
+	streak, freezesUsed := nextStreak(current, today, loc)
+	bonus := streakBonus(cfg.StreakBonuses, streak)
+	longest := current.LongestStreak
+	if streak > longest {
+		longest = streak
+	}
+
+	// The attendance activity is keyed by the day, so it can only be applied once per day
+	day := today.Format("2006-01-02")
+	attendKey := activityKey(database.ActivityAttend, m.Author.ID, day)
+	_, err = ledger.Apply(ctx, s, &database.Activity{
+		User:      m.Author.ID,
+		UserName:  m.Author.Username,
+		ChannelId: m.ChannelID,
+		Activity:  database.ActivityAttend,
+		Reward:    attendReward,
+		MessageId: m.ID,
+		Key:       attendKey,
+		Day:       day,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err == database.ErrDuplicateActivity {
+		message := fmt.Sprintf("<@%s> You have already checked in today. Next check-in at <t:%d:F> (<t:%d:R>).", m.Author.ID, nextCheckIn.Unix(), nextCheckIn.Unix())
+		reply(s, m, message)
+		return
+	}
+	if err != nil {
+		logging.Error("Failed to record attendance", err)
+		return
+	}
+
+	user, err := store.CheckIn(ctx, &database.CheckIn{
+		UserID:        m.Author.ID,
+		UserName:      m.Author.Username,
+		JoinedDate:    memberJoinedDate(m),
+		Since:         today,
+		At:            now,
+		CurrentStreak: streak,
+		LongestStreak: longest,
+		StreakFreezes: bonus.Freezes - freezesUsed,
+	})
+	if err != nil {
+		// Give the day back, so that the user keeps no points without a streak and can check in again
+		logging.Error("Failed to record attendance streak", err)
+		revertCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, _, revertErr := ledger.Revert(revertCtx, database.ActivityFilter{Key: attendKey}); revertErr != nil {
+			logging.Error("Failed to revert attendance", revertErr)
+		}
+		reply(s, m, fmt.Sprintf("<@%s> Failed to check you in, please try again.", m.Author.ID))
+		return
+	}
+
+	// The streak bonus is recorded separately from the attendance reward
+	if bonus.Reward > 0 {
+		user, err = ledger.Apply(ctx, s, &database.Activity{
+			User:      m.Author.ID,
+			UserName:  m.Author.Username,
+			ChannelId: m.ChannelID,
+			Activity:  database.ActivityStreak,
+			Reward:    bonus.Reward,
+			MessageId: m.ID,
+			Key:       activityKey(database.ActivityStreak, m.Author.ID, day),
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			logging.Error("Failed to record streak bonus", err)
+			return
+		}
+	}
+
+	fields := []*discordgo.MessageEmbedField{
+		{
+			Name:   "Earned",
+			Value:  fmt.Sprintf("+%d", attendReward),
+			Inline: true,
+		},
+		{
+			Name:   "Points",
+			Value:  fmt.Sprintf("%d", user.Points),
+			Inline: true,
+		},
+		{
+			Name:   "Streak",
+			Value:  fmt.Sprintf("🔥 %d days (best %d)", user.CurrentStreak, user.LongestStreak),
+			Inline: true,
+		},
+	}
+	if bonus.Reward > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Streak Bonus",
+			Value: fmt.Sprintf("+%d for a %d-day streak! 🎉", bonus.Reward, streak),
+		})
+	}
+	if freezesUsed > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Streak Freeze",
+			Value: fmt.Sprintf("Used %d streak freeze(s) to keep your streak. %d left.", freezesUsed, user.StreakFreezes),
+		})
+	}
+
+	// Create an embed message with the attendance result
+	embed := &discordgo.MessageEmbed{
+		Title: "Daily Attendance",
+		Author: &discordgo.MessageEmbedAuthor{
+			Name: m.Author.Username,
+		},
+		Thumbnail: &discordgo.MessageEmbedThumbnail{
+			URL: m.Author.AvatarURL(""),
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text:    fmt.Sprintf("Given to %s#%s", m.Author.Username, m.Author.Discriminator),
+			IconURL: m.Author.AvatarURL(""),
+		},
+		Description: fmt.Sprintf("Thanks for checking in! Next check-in at <t:%d:F>.", nextCheckIn.Unix()),
+		Color:       0x00aaff,
+		Timestamp:   now.Format(time.RFC3339),
+		Fields:      fields,
+	}
+	// Send the embed message as a reply to the original message
+	sendEmbed(s, m, embed)
+}
+
+// nextStreak returns the streak of the user after checking in today and the number of
+// streak freezes needed to cover the days missed since the last check-in.
+func nextStreak(user *database.User, today time.Time, loc *time.Location) (streak int, freezesUsed int) {
+	if user.LastAttendance.IsZero() {
+		return 1, 0
+	}
+	missed := daysBetween(startOfDay(user.LastAttendance, loc), today) - 1
+	if missed <= 0 {
+		return user.CurrentStreak + 1, 0
+	}
+	if missed <= user.StreakFreezes {
+		return user.CurrentStreak + 1, missed
+	}
+	return 1, 0
+}
+
+// activeStreak returns the streak the user still holds today, which is zero once
+// the user missed more days than their streak freezes can cover.
+func activeStreak(user *database.User, now time.Time, loc *time.Location) int {
+	if user.LastAttendance.IsZero() {
+		return 0
+	}
+	missed := daysBetween(startOfDay(user.LastAttendance, loc), startOfDay(now, loc)) - 1
+	if missed > user.StreakFreezes {
+		return 0
+	}
+	return user.CurrentStreak
+}
+
+// streakBonus returns the bonus reached at exactly the given streak length
+func streakBonus(bonuses []config.StreakBonus, streak int) config.StreakBonus {
+	var total config.StreakBonus
+	for _, bonus := range bonuses {
+		if bonus.Days == streak {
+			total.Days = bonus.Days
+			total.Reward += bonus.Reward
+			total.Freezes += bonus.Freezes
+		}
+	}
+	return total
+}
+
+// daysBetween returns the number of calendar days from one start of day to another
+func daysBetween(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
+
+// memberJoinedDate returns when the message author joined the guild, or now if it is unknown
+func memberJoinedDate(m *discordgo.MessageCreate) time.Time {
+	if m.Member != nil && !m.Member.JoinedAt.IsZero() {
+		return m.Member.JoinedAt
+	}
+	return time.Now().UTC()
+}
@@ -0,0 +1,201 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// auditBatchSize is the number of entries posted at once, the most embeds a message can hold
+const auditBatchSize = 10
+
+// auditTitles maps the audit events to the titles of their embeds
+var auditTitles = map[string]string{
+	database.AuditPoints:          "Points Changed",
+	database.AuditPointsReverted:  "Points Reverted",
+	database.AuditRevertSkipped:   "Revert Skipped",
+	database.AuditReactionRemoved: "Reaction Removed",
+	database.AuditMemberJoin:      "Member Joined",
+	database.AuditMemberLeave:     "Member Left",
+	database.AuditMembersPurged:   "Members Purged",
+	database.AuditMemberTimeout:   "Member Timed Out",
+	database.AuditCommand:         "Admin Command",
+	database.AuditCommandDenied:   "Command Denied",
+	database.AuditRoleExpired:     "Temporary Role Expired",
+	database.AuditPayoutOwed:      "Payout Owed",
+}
+
+// Auditor records the changes made by the bot in the audit collection and posts them to the
+// audit log channel. Entries are batched, so that bursts of events don't hit the rate limits.
+type Auditor struct {
+	session   *discordgo.Session
+	store     database.Store
+	channelID string
+	interval  time.Duration
+	entries   chan database.AuditEntry
+	done      chan struct{} // closed once Run returned
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAuditor creates a new Auditor instance, which records nothing until Run is called
+func NewAuditor(session *discordgo.Session, store database.Store, cfg *config.Config) *Auditor {
+	return &Auditor{
+		session:   session,
+		store:     store,
+		channelID: cfg.Audit.ChannelID,
+		interval:  cfg.Audit.FlushInterval,
+		entries:   make(chan database.AuditEntry, 256),
+		done:      make(chan struct{}),
+	}
+}
+
+// Record queues the entry to be recorded. Entries are dropped when the queue is full,
+// so that auditing never blocks the event handlers.
+func (a *Auditor) Record(entry database.AuditEntry) {
+	if a == nil {
+		return
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		logging.Warn(fmt.Sprintf("Audit log is closed, dropping %s entry for user %s", entry.Event, entry.UserID))
+		return
+	}
+	select {
+	case a.entries <- entry:
+	default:
+		logging.Warn(fmt.Sprintf("Audit queue is full, dropping %s entry for user %s", entry.Event, entry.UserID))
+	}
+}
+
+// Run records the queued entries in batches, once a batch is full or the flush interval passed.
+// It returns once Close was called and the remaining entries were recorded.
+func (a *Auditor) Run() {
+	defer close(a.done)
+	interval := a.interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]database.AuditEntry, 0, auditBatchSize)
+	for {
+		select {
+		case entry, ok := <-a.entries:
+			if !ok {
+				a.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) == auditBatchSize {
+				a.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			a.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// Close stops queueing entries and waits until Run recorded the queued ones, or ctx is done
+func (a *Auditor) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.entries)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush stores the entries and posts them to the audit log channel
+func (a *Auditor) flush(batch []database.AuditEntry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := a.store.InsertAudit(ctx, batch)
+	if err != nil {
+		logging.Error("Failed to store audit entries", err)
+	}
+
+	if a.channelID == "" {
+		return
+	}
+	embeds := make([]*discordgo.MessageEmbed, len(batch))
+	for i := range batch {
+		embeds[i] = auditEmbed(&batch[i])
+	}
+	_, err = a.session.ChannelMessageSendComplex(a.channelID, &discordgo.MessageSend{
+		Embeds:          embeds,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		logging.Error("Failed to post audit entries", err)
+	}
+}
+
+// auditEmbed builds the embed describing the entry
+func auditEmbed(entry *database.AuditEntry) *discordgo.MessageEmbed {
+	title, ok := auditTitles[entry.Event]
+	if !ok {
+		title = entry.Event
+	}
+
+	var fields []*discordgo.MessageEmbedField
+	if entry.UserID != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "User", Value: fmt.Sprintf("<@%s>", entry.UserID), Inline: true})
+	}
+	if entry.ActorID != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "By", Value: fmt.Sprintf("<@%s>", entry.ActorID), Inline: true})
+	}
+	if entry.Before != nil && entry.After != nil {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Points",
+			Value:  fmt.Sprintf("%d → %d (%+d)", *entry.Before, *entry.After, *entry.After-*entry.Before),
+			Inline: true,
+		})
+	}
+	if entry.Source != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Source", Value: entry.Source, Inline: true})
+	}
+	if entry.ChannelID != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Channel", Value: fmt.Sprintf("<#%s>", entry.ChannelID), Inline: true})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       title,
+		Description: entry.Details,
+		Color:       0x00aaff,
+		Timestamp:   entry.CreatedAt.Format(time.RFC3339),
+		Fields:      fields,
+	}
+}
+
+// pointsChange returns the points before and after a change, for audit entries
+func pointsChange(after, reward int) (*int, *int) {
+	before := after - reward
+	return &before, &after
+}
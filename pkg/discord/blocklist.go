@@ -0,0 +1,158 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// blocklistUsage explains the arguments of the !blocklist command
+const blocklistUsage = "Usage: `!blocklist add|remove <emoji> [#channel]` or `!blocklist list`"
+
+// channelMentionPattern matches a channel mention and captures the channel ID
+var channelMentionPattern = regexp.MustCompile(`^<#(\d+)>$`)
+
+// BlocklistCommand returns a command handler function for the !blocklist command
+func BlocklistCommand(cfg *config.Config, blocklist *Blocklist) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleBlocklist(s, m, args, cfg, blocklist)
+	}
+}
+
+// blocklistOptions returns the slash command options of the !blocklist command
+func blocklistOptions() []*discordgo.ApplicationCommandOption {
+	edit := func(name, description string) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        name,
+			Description: description,
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "emoji", Description: "The emoji", Required: true},
+				{Type: discordgo.ApplicationCommandOptionChannel, Name: "channel", Description: "Only in this channel, every channel when empty"},
+			},
+		}
+	}
+	return []*discordgo.ApplicationCommandOption{
+		edit("add", "Block a reaction"),
+		edit("remove", "Unblock a reaction"),
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "list",
+			Description: "Show the blocked reactions",
+		},
+	}
+}
+
+// handleBlocklist handles the !blocklist command, letting admins block and unblock reactions
+func handleBlocklist(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, blocklist *Blocklist) {
+	if len(args) == 0 {
+		reply(s, m, blocklistUsage)
+		return
+	}
+	if args[0] == "list" {
+		showBlocklist(s, m, cfg, blocklist)
+		return
+	}
+	if len(args) < 2 || (args[0] != "add" && args[0] != "remove") {
+		reply(s, m, blocklistUsage)
+		return
+	}
+
+	emoji := normalizeEmoji(args[1])
+	channelID := ""
+	where := "every channel"
+	if len(args) > 2 {
+		match := channelMentionPattern.FindStringSubmatch(args[2])
+		if match == nil {
+			reply(s, m, blocklistUsage)
+			return
+		}
+		channelID = match[1]
+		where = fmt.Sprintf("<#%s>", channelID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if args[0] == "add" {
+		err := blocklist.Add(ctx, emoji, channelID, m.Author.ID)
+		switch {
+		case err == database.ErrAlreadyExists:
+			reply(s, m, fmt.Sprintf("%s is already blocked in %s.", args[1], where))
+		case err != nil:
+			logging.Error("Failed to block reaction", err)
+			reply(s, m, "Failed to block the reaction, please check the logs.")
+		default:
+			reply(s, m, fmt.Sprintf("%s is now blocked in %s.", args[1], where))
+		}
+		return
+	}
+
+	err := blocklist.Remove(ctx, emoji, channelID)
+	switch {
+	case err == database.ErrNotFound && channelID == "" && contains(cfg.Moderation.BlockedReactions, emoji):
+		reply(s, m, fmt.Sprintf("%s is blocked in the config and cannot be unblocked with this command.", args[1]))
+	case err == database.ErrNotFound:
+		reply(s, m, fmt.Sprintf("%s is not blocked in %s.", args[1], where))
+	case err != nil:
+		logging.Error("Failed to unblock reaction", err)
+		reply(s, m, "Failed to unblock the reaction, please check the logs.")
+	default:
+		reply(s, m, fmt.Sprintf("%s is no longer blocked in %s.", args[1], where))
+	}
+}
+
+// showBlocklist sends the blocked reactions, grouped by where they are blocked
+func showBlocklist(s *discordgo.Session, m *discordgo.MessageCreate, cfg *config.Config, blocklist *Blocklist) {
+	everywhere := append([]string(nil), cfg.Moderation.BlockedReactions...)
+	byChannel := make(map[string][]string)
+	var channels []string
+	for _, blocked := range blocklist.List() {
+		emoji := displayEmoji(blocked.Emoji)
+		if blocked.ChannelID == "" {
+			everywhere = append(everywhere, emoji)
+			continue
+		}
+		if _, ok := byChannel[blocked.ChannelID]; !ok {
+			channels = append(channels, blocked.ChannelID)
+		}
+		byChannel[blocked.ChannelID] = append(byChannel[blocked.ChannelID], emoji)
+	}
+
+	fields := []*discordgo.MessageEmbedField{}
+	if len(everywhere) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Every channel", Value: strings.Join(everywhere, " ")})
+	}
+	for _, channelID := range channels {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Channel",
+			Value: fmt.Sprintf("<#%s> %s", channelID, strings.Join(byChannel[channelID], " ")),
+		})
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Blocked Reactions",
+		Color:     0x00aaff,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Fields:    fields,
+	}
+	if len(fields) == 0 {
+		embed.Description = "No reactions are blocked."
+	}
+	sendEmbed(s, m, embed)
+}
+
+// displayEmoji writes a blocked emoji so that custom emojis show in messages
+func displayEmoji(emoji string) string {
+	if name, id, ok := strings.Cut(emoji, ":"); ok {
+		return fmt.Sprintf("<:%s:%s>", name, id)
+	}
+	return emoji
+}
@@ -0,0 +1,90 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/leveling"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/augustine0890/dapp-bot/pkg/rankcard"
+	"github.com/bwmarrin/discordgo"
+)
+
+// CardCommand returns a command handler function for the !card command
+func CardCommand(cfg *config.Config, store database.Store, curve leveling.Curve) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleCard(s, m, args, cfg, store, curve)
+	}
+}
+
+// handleCard handles the !card command, sending the user's rank card as an image
+func handleCard(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, store database.Store, curve leveling.Curve) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := store.GetUser(ctx, m.Author.ID)
+	if err != nil {
+		logging.Error("Failed retrieving user points", err)
+		return
+	}
+
+	rank, _, err := store.UserRank(ctx, m.Author.ID)
+	if err != nil {
+		logging.Error("Failed to get user ranking", err)
+		return
+	}
+
+	progress := leveling.GetProgress(curve, user.Points)
+	if progress.RequiredXP == 0 {
+		// Fill the progress bar at the max level
+		progress.RequiredXP = progress.CurrentXP
+	}
+
+	card := rankcard.NewRankCard()
+	card.SetAvatar(m.Author.AvatarURL("256"))
+	card.SetUsername(m.Author.Username, "#FFFFFF")
+	card.SetDiscriminator(m.Author.Discriminator, "#7F8384")
+	card.SetStatus(memberStatus(s, m), false, false)
+	card.SetRank(rank, "RANK", true)
+	card.SetLevel(progress.Level, "LEVEL", true)
+	card.SetCurrentXP(progress.CurrentXP)
+	card.SetRequiredXP(progress.RequiredXP)
+	// Backgrounds bought in the shop are hex colors or image URLs
+	if strings.HasPrefix(user.Background, "#") {
+		card.SetBackground("color", user.Background)
+	} else if user.Background != "" {
+		card.SetBackground("image", user.Background)
+	}
+
+	var buf bytes.Buffer
+	if err := card.Render(&buf); err != nil {
+		logging.Error("Failed to render rank card", err)
+		return
+	}
+
+	_, err = sendComplex(s, m, &discordgo.MessageSend{
+		Files: []*discordgo.File{
+			{Name: "rank.png", ContentType: "image/png", Reader: &buf},
+		},
+	})
+	if err != nil {
+		logging.Error("Error sending message to channel.", err)
+	}
+}
+
+// memberStatus returns the presence status of the message author, assuming online
+// when the presence is not cached since the author has just sent a message.
+func memberStatus(s *discordgo.Session, m *discordgo.MessageCreate) string {
+	presence, err := s.State.Presence(m.GuildID, m.Author.ID)
+	if err != nil || presence.Status == "" {
+		return string(discordgo.StatusOnline)
+	}
+	if presence.Status == discordgo.StatusInvisible {
+		return string(discordgo.StatusOffline)
+	}
+	return string(presence.Status)
+}
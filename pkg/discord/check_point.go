@@ -6,58 +6,87 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/augustine0890/dapp-bot/internal/database"
 	"github.com/augustine0890/dapp-bot/pkg/config"
 	"github.com/augustine0890/dapp-bot/pkg/logging"
 	"github.com/bwmarrin/discordgo"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // CheckPointCommand returns a command handler function for the !checkpoint command
-func CheckPointCommand(cfg *config.Config, mongoClient *mongo.Client) CommandHandlerFunc {
+func CheckPointCommand(cfg *config.Config, store database.Store) CommandHandlerFunc {
 	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-		handleCheckPoint(s, m, args, cfg, mongoClient)
+		handleCheckPoint(s, m, args, cfg, store)
 	}
 }
 
-func RankCommand(cfg *config.Config, mongoClient *mongo.Client) CommandHandlerFunc {
+// RankCommand returns a command handler function for the !rank command
+func RankCommand(cfg *config.Config, store database.Store) CommandHandlerFunc {
 	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-		handleRank(s, m, args, cfg, mongoClient)
+		handleRank(s, m, args, cfg, store)
 	}
 }
 
-func MyRankCommand(cfg *config.Config, mongoClient *mongo.Client) CommandHandlerFunc {
+func MyRankCommand(cfg *config.Config, store database.Store) CommandHandlerFunc {
 	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-		handleMyRank(s, m, args, cfg, mongoClient)
+		handleMyRank(s, m, args, cfg, store)
 	}
 }
 
+// leaderboardPageSize is the number of users shown per page of the leaderboard
+const leaderboardPageSize = 10
+
+// rankComponent is the custom ID prefix of the leaderboard page buttons
+const rankComponent = "rank"
+
+// rankUsage explains the arguments of the !rank command
+const rankUsage = "Usage: `!rank [daily|weekly|monthly|all] [page]`"
+
+// Leaderboard periods
+const (
+	periodDaily   = "daily"
+	periodWeekly  = "weekly"
+	periodMonthly = "monthly"
+	periodAll     = "all"
+)
+
+// leaderboardTitles maps the leaderboard periods to the titles of their embeds
+var leaderboardTitles = map[string]string{
+	periodDaily:   "Today's Points",
+	periodWeekly:  "This Week's Points",
+	periodMonthly: "This Month's Points",
+	periodAll:     "The Cumulative Points",
+}
+
+// The image attached to the leaderboard
+const (
+	winnersImagePath = "./assets/images/winners.jpg"
+	winnersImageName = "winners.jpg"
+)
+
+var (
+	winnersOnce sync.Once
+	winnersData []byte
+	winnersErr  error
+)
+
+// winnersImage returns the leaderboard image, read from disk the first time only
+func winnersImage() ([]byte, error) {
+	winnersOnce.Do(func() {
+		winnersData, winnersErr = os.ReadFile(winnersImagePath)
+	})
+	return winnersData, winnersErr
+}
+
 // HandleCheckPoint handles the !checkpoint command, sending the user's points as an embed message
-func handleCheckPoint(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, mongoClient *mongo.Client) {
+func handleCheckPoint(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, store database.Store) {
 	// Retrieve the user's points from MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	usersColl := database.GetUsersColl(mongoClient, cfg)
-
-	attendanceChannelID := cfg.AttendanceID
-	if m.ChannelID != attendanceChannelID {
-		message := fmt.Sprintf("<@%s> Please go to the <#%s> channel for Daily Attendance and Points Checking.", m.Author.ID, attendanceChannelID)
-		_, err := s.ChannelMessageSend(m.ChannelID, message)
-		if err != nil {
-			logging.Error("Error sending message", err)
-		}
-		return
-	}
-
-	userID := m.Author.ID
-	filter := bson.M{"_id": userID}
-	var user database.User
-	err := usersColl.FindOne(ctx, filter).Decode(&user)
+	user, err := store.GetUser(ctx, m.Author.ID)
 	if err != nil {
 		logging.Error("Failed retrieving user points", err)
 		return
@@ -84,199 +113,264 @@ func handleCheckPoint(s *discordgo.Session, m *discordgo.MessageCreate, args []s
 				Value:  fmt.Sprintf("%d", user.Points),
 				Inline: true,
 			},
+			{
+				Name:   "Streak",
+				Value:  fmt.Sprintf("🔥 %d days (best %d)", activeStreak(user, time.Now(), cfg.Location()), user.LongestStreak),
+				Inline: true,
+			},
+			{
+				Name:   "Streak Freezes",
+				Value:  fmt.Sprintf("%d", user.StreakFreezes),
+				Inline: true,
+			},
 		},
 	}
 	// Send the embed message as a reply to the original message
-	s.ChannelMessageSendEmbed(m.ChannelID, embed)
+	sendEmbed(s, m, embed)
 }
 
-func handleRank(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, mongoClient *mongo.Client) {
-	// Get the users collection from MongoDB
-	// Retrieve the user's points from MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	attendanceChannelID := cfg.AttendanceID
-	if m.ChannelID != attendanceChannelID {
-		message := fmt.Sprintf("<@%s> Please go to the <#%s> channel for Daily Attendance and Points Checking.", m.Author.ID, attendanceChannelID)
-		_, err := s.ChannelMessageSend(m.ChannelID, message)
-		if err != nil {
-			logging.Error("Error sending message", err)
-		}
+// handleRank handles the !rank [daily|weekly|monthly|all] [page] command, sending a page of the
+// leaderboard with buttons to move between pages
+func handleRank(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, store database.Store) {
+	period, page, ok := parseRankArgs(args)
+	if !ok {
+		reply(s, m, rankUsage)
 		return
 	}
 
-	usersColl := database.GetUsersColl(mongoClient, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	// Find the top 10 users based on their points
-	findOptions := options.Find()
-	findOptions.SetSort(bson.D{{Key: "points", Value: -1}, {Key: "updatedAt", Value: 1}})
-	findOptions.SetLimit(10)
-	cursor, err := usersColl.Find(ctx, bson.M{}, findOptions)
+	embed, components, err := buildLeaderboard(ctx, s, cfg, store, period, page, m.Author)
 	if err != nil {
 		msg := "Error fetching user data from the database"
 		logging.Error(msg, err)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	// Create the fields for each user in the top 10
-	// Build the list of rank fields
-	topRank := make([]*discordgo.MessageEmbedField, 0, 10)
-	emojiRank := []string{"🥇", "🥈", "🥉", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣", "🔟"}
-	i := 0
-	for cursor.Next(ctx) {
-		// Decode the user document
-		var rankUser database.User
-		err := cursor.Decode(&rankUser)
-		if err != nil {
-			logging.Error("Failed to get rank.", err)
-			return
-		}
-
-		// Add the user to the list of rank fields
-		topRank = append(topRank, &discordgo.MessageEmbedField{
-			Name:  emojiRank[i] + " " + rankUser.UserName,
-			Value: strconv.Itoa(rankUser.Points) + " 🧧",
-		})
-		i++
+	// Create a new discordgo file from the cached image
+	imageData, err := winnersImage()
+	if err != nil {
+		logging.Error("Failed to read image file:", err)
+		return
 	}
+	image := &discordgo.File{Name: winnersImageName, Reader: bytes.NewReader(imageData)}
 
-	if err := cursor.Err(); err != nil {
-		logging.Error("Failed to get rank.", err)
+	// Send the message with the image
+	_, err = sendComplex(s, m, &discordgo.MessageSend{
+		Embed:      embed,
+		Files:      []*discordgo.File{image},
+		Components: components,
+	})
+	if err != nil {
+		logging.Error("Error sending message to channel.", err)
 		return
 	}
+}
 
-	// Open the image file
-	imageFile, err := os.Open("./assets/images/winners.jpg")
-	if err != nil {
-		logging.Error("Failed to open image file:", err)
+// RankPageHandler returns a component handler function for the leaderboard page buttons
+func RankPageHandler(cfg *config.Config, store database.Store) ComponentHandlerFunc {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+		handleRankPage(s, i, args, cfg, store)
+	}
+}
+
+// handleRankPage replaces the leaderboard with the page of the clicked button when the user who
+// asked for it clicked, and shows the page only to the user who clicked otherwise, so that the
+// shared leaderboard keeps the position of the user who asked for it
+func handleRankPage(s *discordgo.Session, i *discordgo.InteractionCreate, args []string, cfg *config.Config, store database.Store) {
+	if len(args) != 3 {
 		return
 	}
-	defer imageFile.Close()
-	// Get the file info
-	fileInfo, err := imageFile.Stat()
-	if err != nil {
-		logging.Error("Failed to get image file info:", err)
+	period, callerID := args[0], args[2]
+	if _, ok := leaderboardTitles[period]; !ok {
 		return
 	}
-
-	// Read the image file into a byte slice
-	imageData := make([]byte, fileInfo.Size())
-	_, err = imageFile.Read(imageData)
+	page, err := strconv.Atoi(args[1])
 	if err != nil {
-		logging.Error("Failed to read image file:", err)
 		return
 	}
-	// Create a new discordgo file from the byte slice
-	image := &discordgo.File{Name: fileInfo.Name(), Reader: bytes.NewReader(imageData)}
-	// Create a new embed message
-	embed := &discordgo.MessageEmbed{
-		Title:       "🏆 The Cumulative Points TOP 10 Leaderboard 🏆",
-		Description: "Congratulations! You made it! 🥳",
-		Color:       0x00AAFF,
-		Fields:      topRank,
-		Image: &discordgo.MessageEmbedImage{
-			URL:      "attachment://" + image.Name,
-			Width:    400,
-			ProxyURL: "",
-		},
-		Footer: &discordgo.MessageEmbedFooter{
-			Text:    fmt.Sprintf("Made by %s", s.State.User.Username),
-			IconURL: s.State.User.AvatarURL(""),
-		},
-		Timestamp: time.Now().Format(time.RFC3339),
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
 	}
 
-	// Send the message with the image
-	_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
-		Embed: embed,
-		Files: []*discordgo.File{image},
-	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	embed, components, err := buildLeaderboard(ctx, s, cfg, store, period, page, user)
 	if err != nil {
-		logging.Error("Error sending message to channel.", err)
+		logging.Error("Error fetching user data from the database", err)
 		return
 	}
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	}
+	if user.ID != callerID {
+		imageData, err := winnersImage()
+		if err != nil {
+			logging.Error("Failed to read image file:", err)
+			return
+		}
+		response.Type = discordgo.InteractionResponseChannelMessageWithSource
+		response.Data.Files = []*discordgo.File{{Name: winnersImageName, Reader: bytes.NewReader(imageData)}}
+		response.Data.Flags = discordgo.MessageFlagsEphemeral
+	}
+	if err := s.InteractionRespond(i.Interaction, response); err != nil {
+		logging.Error("Failed to update leaderboard", err)
+	}
 }
 
-func handleMyRank(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, mongoClient *mongo.Client) {
-	// Retrieve the user's points from MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// buildLeaderboard builds the embed showing a page of the leaderboard of the period, followed by
+// the position of the caller when they are not on the page, and the buttons to change the page,
+// which carry the ID of the caller
+func buildLeaderboard(ctx context.Context, s *discordgo.Session, cfg *config.Config, store database.Store, period string, page int, caller *discordgo.User) (*discordgo.MessageEmbed, []discordgo.MessageComponent, error) {
+	since := periodStart(period, time.Now(), cfg.Location())
+	if page < 1 {
+		page = 1
+	}
+	entries, total, err := store.Leaderboard(ctx, since, (page-1)*leaderboardPageSize, leaderboardPageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	pages := (total + leaderboardPageSize - 1) / leaderboardPageSize
+	if pages == 0 {
+		pages = 1
+	}
+	if page > pages {
+		// The leaderboard got shorter, show its last page instead
+		page = pages
+		entries, total, err = store.Leaderboard(ctx, since, (page-1)*leaderboardPageSize, leaderboardPageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-	usersColl := database.GetUsersColl(mongoClient, cfg)
+	// Build the list of rank fields
+	topRank := make([]*discordgo.MessageEmbedField, 0, leaderboardPageSize+1)
+	onPage := false
+	for i, entry := range entries {
+		rank := (page-1)*leaderboardPageSize + i + 1
+		topRank = append(topRank, &discordgo.MessageEmbedField{
+			Name:  rankLabel(rank) + " " + entry.UserName,
+			Value: strconv.Itoa(entry.Points) + " 🧧",
+		})
+		onPage = onPage || entry.UserID == caller.ID
+	}
 
-	attendanceChannelID := cfg.AttendanceID
-	if m.ChannelID != attendanceChannelID {
-		message := fmt.Sprintf("<@%s> Please go to the <#%s> channel for Daily Attendance and Points Checking.", m.Author.ID, attendanceChannelID)
-		_, err := s.ChannelMessageSend(m.ChannelID, message)
+	// Add the position of the caller when they are not on the page
+	if !onPage {
+		rank, entry, err := store.LeaderboardPosition(ctx, since, caller.ID)
 		if err != nil {
-			logging.Error("Error sending message", err)
+			return nil, nil, err
 		}
-		return
+		field := &discordgo.MessageEmbedField{Name: "Your position", Value: "Not ranked yet"}
+		if rank > 0 {
+			field.Value = fmt.Sprintf("%s %s · %d 🧧", rankLabel(rank), entry.UserName, entry.Points)
+		}
+		topRank = append(topRank, field)
 	}
 
-	userID := m.Author.ID
-	// define the pipeline
-	pipeline := bson.A{
-		bson.M{
-			"$match": bson.M{
-				"points": bson.M{"$exists": true},
-			},
+	description := "Congratulations! You made it! 🥳"
+	if total == 0 {
+		description = "Nobody earned points yet, be the first! 🥳"
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("🏆 %s Leaderboard 🏆", leaderboardTitles[period]),
+		Description: description,
+		Color:       0x00AAFF,
+		Fields:      topRank,
+		Image: &discordgo.MessageEmbedImage{
+			URL:   "attachment://" + winnersImageName,
+			Width: 400,
 		},
-		bson.M{
-			"$sort": bson.M{
-				"points": -1,
-			},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text:    fmt.Sprintf("Page %d of %d · Made by %s", page, pages, s.State.User.Username),
+			IconURL: s.State.User.AvatarURL(""),
 		},
-		bson.M{
-			"$group": bson.M{
-				"_id": nil,
-				"rankings": bson.M{
-					"$push": "$_id",
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "◀ Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: componentID(rankComponent, period, strconv.Itoa(page-1), caller.ID),
+					Disabled: page <= 1,
 				},
-			},
-		},
-		bson.M{
-			"$project": bson.M{
-				"rankIndex": bson.M{
-					"$indexOfArray": bson.A{"$rankings", userID},
+				discordgo.Button{
+					Label:    "Next ▶",
+					Style:    discordgo.SecondaryButton,
+					CustomID: componentID(rankComponent, period, strconv.Itoa(page+1), caller.ID),
+					Disabled: page >= pages,
 				},
-				"count": bson.M{"$size": "$rankings"},
-			},
-		},
-		bson.M{
-			"$project": bson.M{
-				"rank":  bson.M{"$add": bson.A{"$rankIndex", 1}},
-				"count": 1,
 			},
 		},
 	}
+	return embed, components, nil
+}
 
-	// execute the aggregation pipeline
-	cursor, err := usersColl.Aggregate(ctx, pipeline)
-	if err != nil {
-		logging.Error("Error aggregation pipeline", err)
-		return
+// parseRankArgs reads the optional period and page of the !rank command
+func parseRankArgs(args []string) (string, int, bool) {
+	period, page := periodAll, 1
+	for _, arg := range args {
+		if _, ok := leaderboardTitles[arg]; ok {
+			period = arg
+			continue
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return "", 0, false
+		}
+		page = n
 	}
+	return period, page, true
+}
 
-	// iterate over the results
-	var result bson.M
-	for cursor.Next(context.Background()) {
-		if err := cursor.Decode(&result); err != nil {
-			logging.Error("Error decoding", err)
-			return
-		}
+// periodStart returns when the period started, or the zero time for all time
+func periodStart(period string, now time.Time, loc *time.Location) time.Time {
+	today := startOfDay(now, loc)
+	switch period {
+	case periodDaily:
+		return today
+	case periodWeekly:
+		// Weeks start on Monday
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	case periodMonthly:
+		return today.AddDate(0, 0, 1-today.Day())
+	default:
+		return time.Time{}
 	}
-	// process the result
-	keys := []string{"rank", "count"}
-	for _, key := range keys {
-		_, ok := result[key]
-		if !ok {
-			msg := fmt.Sprintf("%s is not present in the map\n", key)
-			logging.Warn(msg)
-			return
-		}
+}
+
+// rankLabel returns the emoji of the top 10 ranks, or the rank number
+func rankLabel(rank int) string {
+	emojiRank := []string{"🥇", "🥈", "🥉", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣", "🔟"}
+	if rank <= len(emojiRank) {
+		return emojiRank[rank-1]
+	}
+	return fmt.Sprintf("#%d", rank)
+}
+
+func handleMyRank(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, store database.Store) {
+	// Retrieve the user's points from MongoDB
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rank, count, err := store.UserRank(ctx, m.Author.ID)
+	if err != nil {
+		logging.Error("Failed to get user ranking", err)
+		return
+	}
+	if rank == 0 {
+		logging.Warn(fmt.Sprintf("User %s is not ranked", m.Author.ID))
+		return
 	}
 
 	// Create an embed massage with the user's ranking
@@ -296,12 +390,12 @@ func handleMyRank(s *discordgo.Session, m *discordgo.MessageCreate, args []strin
 		Timestamp: time.Now().Format(time.RFC3339),
 		Fields: []*discordgo.MessageEmbedField{
 			{
-				Name:   fmt.Sprintf("%d out of %d", result["rank"], result["count"]),
+				Name:   fmt.Sprintf("%d out of %d", rank, count),
 				Value:  "Super-Duper! 🎉",
 				Inline: true,
 			},
 		},
 	}
 	// Send the embed message as a reply to the original message
-	s.ChannelMessageSendEmbed(m.ChannelID, embed)
+	sendEmbed(s, m, embed)
 }
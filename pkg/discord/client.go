@@ -1,16 +1,17 @@
 package discord
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
-	"os/signal"
-	"syscall"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/augustine0890/dapp-bot/internal/database"
 	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/leveling"
 	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/augustine0890/dapp-bot/pkg/wager"
 	"github.com/bwmarrin/discordgo"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -20,7 +21,24 @@ type Discord struct {
 	session       *discordgo.Session
 	commandPrefix string
 	mongoClient   *mongo.Client
-	reactionCh    chan *discordgo.MessageReactionAdd
+	store         database.Store
+	cfg           *config.Config
+	commands      *CommandHandler
+	ledger        *Ledger
+	audit         *Auditor
+	blocklist     *Blocklist
+	games         *Games
+	trivia        *Trivia
+	shop          *Shop
+	reactionCh    chan *reactionEvent
+	metrics       *Metrics
+	httpServer    *http.Server // nil when no HTTP address is configured
+
+	handlers     handlerGroup    // event handlers in flight
+	workers      *sync.WaitGroup // background workers and games, which return once stop is closed
+	stop         chan struct{}
+	shutdownOnce sync.Once
+	shutdownErr  error
 }
 
 // NewDiscord creates a new Discord instance for the bot
@@ -31,6 +49,36 @@ func NewDiscord(cfg *config.Config) (*Discord, error) {
 		return nil, fmt.Errorf("failed to connect to create MongoDB client: %w", err)
 	}
 
+	// Disconnect from MongoDB again when the bot cannot be created
+	created := false
+	defer func() {
+		if created {
+			return
+		}
+		disconnectCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := mongoClient.Disconnect(disconnectCtx); err != nil {
+			logging.Error("Failed to disconnect from MongoDB", err)
+		}
+	}()
+
+	store := database.NewMongoStore(mongoClient, cfg)
+
+	// Create the level curve used to turn points into levels
+	levels, err := leveling.NewCurve(cfg.Leveling)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create level curve: %w", err)
+	}
+
+	// Make sure the indexes and documents are up to date
+	err = migrate(store, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
 	// Create a new Discord session
 	session, err := discordgo.New("Bot " + cfg.DiscordToken)
 	if err != nil {
@@ -40,61 +88,282 @@ func NewDiscord(cfg *config.Config) (*Discord, error) {
 	intents := discordgo.IntentsGuildMessages | discordgo.IntentsGuildMessageReactions | discordgo.IntentsGuildMembers
 	session.Identify.Intents = intents
 
-	// Create a new CommandHandler and register commands
-	ch := NewCommandHandler()
-	ch.RegisterCommand(HandlePing, "ping")
-	ch.RegisterCommand(HandlePlayDapp, "dapp")
-	ch.RegisterCommand(CheckPointCommand(cfg, mongoClient), "cp", "checkpoint")
-	ch.RegisterCommand(RankCommand(cfg, mongoClient), "r", "rank")
-	ch.RegisterCommand(MyRankCommand(cfg, mongoClient), "mr", "myrank")
+	// Record the changes made by the bot in the audit log
+	audit := NewAuditor(session, store, cfg)
+	metrics := NewMetrics()
+	ledger := NewLedger(store, cfg, levels, audit, metrics)
 
-	// Register the command handler function
-	session.AddHandler(ch.HandleCommand)
+	// Load the reactions which are removed from messages
+	blocklist := NewBlocklist(store, cfg, ledger, audit)
+	err = blocklist.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load blocked reactions: %w", err)
+	}
 
-	// Register the member join/leave handler function
-	RegisterHandler(session, mongoClient, cfg, &discordgo.GuildMemberAdd{}, HandleMember)
-	RegisterHandler(session, mongoClient, cfg, &discordgo.GuildMemberRemove{}, HandleMember)
+	// Create the point wagering games, resolved with a seeded RNG when one is configured
+	wagers := NewWagers(store, cfg, ledger, audit, wager.NewRNG(cfg.Wagers.Seed))
 
-	// Register additional event handlers here as needed
+	// Create the shop selling the items added by admins
+	shop := NewShop(store, cfg, ledger, audit)
 
-	session.AddHandler(HandleRemoveReaction)
+	// The games in progress are waited for on shutdown, with the background workers
+	workers := new(sync.WaitGroup)
+
+	// Load the trivia questions, a missing bank only disables trivia until it is reloaded
+	host := NewTrivia(cfg, ledger, workers)
+	if _, err := host.Load(); err != nil {
+		logging.Warn("Failed to load trivia question bank", err)
+	}
+
+	// Create the minigames played with !dapp, whose trivia shares the question bank
+	games := NewGames(store, cfg, ledger, host, workers)
+
+	// Create a new CommandHandler and register commands
+	minPage := 1.0
+	ch := NewCommandHandler(cfg, audit)
+	ch.RegisterCommand(&Command{
+		Name:        "ping",
+		Description: "Check that the bot is alive",
+		Handler:     HandlePing,
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "dapp",
+		Description: "Play a minigame with DappBot",
+		Options:     gamesOptions(),
+		Handler:     GamesCommand(cfg, games),
+		Cooldown:    Cooldown{User: 5 * time.Second},
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "attend",
+		Aliases:     []string{"a"},
+		Description: "Check in for the daily attendance points",
+		Handler:     AttendCommand(cfg, store, ledger),
+		Channels:    []string{cfg.AttendanceID},
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "checkpoint",
+		Aliases:     []string{"cp"},
+		Description: "Show your cumulative points",
+		Handler:     CheckPointCommand(cfg, store),
+		Channels:    []string{cfg.AttendanceID},
+		Cooldown:    Cooldown{User: 5 * time.Second},
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "rank",
+		Aliases:     []string{"r"},
+		Description: "Show the points leaderboard",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "period",
+				Description: "The period the points were earned in",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "daily", Value: periodDaily},
+					{Name: "weekly", Value: periodWeekly},
+					{Name: "monthly", Value: periodMonthly},
+					{Name: "all", Value: periodAll},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "page",
+				Description: "The page to show",
+				MinValue:    &minPage,
+			},
+		},
+		Handler:  RankCommand(cfg, store),
+		Channels: []string{cfg.AttendanceID},
+		Cooldown: Cooldown{User: 30 * time.Second, Channel: 10 * time.Second},
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "myrank",
+		Aliases:     []string{"mr"},
+		Description: "Show your ranking",
+		Handler:     MyRankCommand(cfg, store),
+		Channels:    []string{cfg.AttendanceID},
+		Cooldown:    Cooldown{User: 5 * time.Second},
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "card",
+		Aliases:     []string{"c"},
+		Description: "Show your rank card",
+		Handler:     CardCommand(cfg, store, levels),
+		Channels:    []string{cfg.AttendanceID},
+		Cooldown:    Cooldown{User: 15 * time.Second},
+	})
+	ch.RegisterCommand(adminOnly(cfg, &Command{
+		Name:        "reconcile",
+		Description: "Compare the points of users with their activities (admin only)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "mode",
+				Description: "Only report the differences or also repair them",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "check", Value: "check"},
+					{Name: "repair", Value: "repair"},
+				},
+			},
+		},
+		Handler:  ReconcileCommand(cfg, store),
+		Cooldown: Cooldown{User: 10 * time.Second},
+	}))
+	ch.RegisterCommand(adminOnly(cfg, &Command{
+		Name:        "sync",
+		Description: "Sync the users with the members of the guild (admin only)",
+		Handler:     SyncCommand(cfg, store),
+		Cooldown:    Cooldown{User: 30 * time.Second},
+	}))
+	ch.RegisterCommand(adminOnly(cfg, &Command{
+		Name:        "points",
+		Description: "Change the points of a member or show their history (admin only)",
+		Options:     pointsOptions(),
+		Handler:     PointsCommand(cfg, store, ledger),
+	}))
+	ch.RegisterCommand(adminOnly(cfg, &Command{
+		Name:        "blocklist",
+		Description: "Block or unblock reactions (admin only)",
+		Options:     blocklistOptions(),
+		Handler:     BlocklistCommand(cfg, blocklist),
+	}))
+
+	ch.RegisterCommand(&Command{
+		Name:        "flip",
+		Description: "Bet points on a coin flip",
+		Options:     flipOptions(cfg),
+		Handler:     FlipCommand(cfg, wagers),
+		Channels:    cfg.Wagers.Channels,
+		Cooldown:    Cooldown{User: 3 * time.Second},
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "slots",
+		Description: "Bet points on the slot machine",
+		Options:     slotsOptions(cfg),
+		Handler:     SlotsCommand(cfg, wagers),
+		Channels:    cfg.Wagers.Channels,
+		Cooldown:    Cooldown{User: 3 * time.Second},
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "shop",
+		Description: "Show the items for sale or the items you bought",
+		Options:     shopOptions(),
+		Handler:     ShopCommand(cfg, shop),
+		Channels:    cfg.Shop.Channels,
+		Cooldown:    Cooldown{User: 5 * time.Second},
+	})
+	ch.RegisterCommand(&Command{
+		Name:        "buy",
+		Description: "Buy an item from the shop",
+		Options:     buyOptions(),
+		Handler:     BuyCommand(cfg, shop),
+		Channels:    cfg.Shop.Channels,
+		Cooldown:    Cooldown{User: 3 * time.Second},
+	})
+	ch.RegisterCommand(adminOnly(cfg, &Command{
+		Name:        "shopadmin",
+		Description: "Manage the items of the shop (admin only)",
+		Options:     shopAdminOptions(),
+		Handler:     ShopAdminCommand(cfg, shop),
+	}))
+	ch.RegisterCommand(adminOnly(cfg, &Command{
+		Name:        "trivia",
+		Description: "Run a trivia game in this channel (admin only)",
+		Options:     triviaOptions(),
+		Handler:     TriviaCommand(cfg, host),
+	}))
+
+	ch.RegisterComponent(rankComponent, RankPageHandler(cfg, store))
+	ch.RegisterComponent(triviaComponent, TriviaAnswerHandler(host))
 
 	// Create a new Discord instance
 	d := &Discord{
 		session:       session,
 		commandPrefix: "!",
 		mongoClient:   mongoClient,
-		reactionCh:    make(chan *discordgo.MessageReactionAdd),
+		store:         store,
+		cfg:           cfg,
+		commands:      ch,
+		ledger:        ledger,
+		audit:         audit,
+		blocklist:     blocklist,
+		games:         games,
+		trivia:        host,
+		shop:          shop,
+		reactionCh:    make(chan *reactionEvent, 100),
+		workers:       workers,
+		stop:          make(chan struct{}),
+		metrics:       metrics,
 	}
+	if cfg.HTTPAddr != "" {
+		d.httpServer = d.newHTTPServer()
+	}
+
+	// Register the command handler functions for prefix and slash commands
+	session.AddHandler(track(d, ch.HandleCommand))
+	session.AddHandler(track(d, ch.HandleInteraction))
+
+	// Register the handlers passing the answers of players to their games
+	session.AddHandler(track(d, games.HandleMessage))
+	session.AddHandler(track(d, host.HandleMessage))
+
+	// Register the member join/leave handler function
+	d.RegisterHandler(&discordgo.GuildMemberAdd{}, MemberHandler(audit))
+	d.RegisterHandler(&discordgo.GuildMemberRemove{}, MemberHandler(audit))
+
+	// Register the ready handler function, which syncs the users with the guild members
+	d.RegisterHandler(&discordgo.Ready{}, HandleReady)
 
-	// Register the ready command handler function
-	// session.AddHandler(HandleReady)
+	// Register the message reaction handler functions
+	session.AddHandler(track(d, d.HandleRemoveReaction))
+	session.AddHandler(track(d, d.HandleReaction))
+	session.AddHandler(track(d, d.HandleReactionRemove))
 
-	// Register the message reaction handler function
-	// session.AddHandler(d.HandleReaction)
+	// Register the gateway connection handlers, for monitoring
+	session.AddHandler(metrics.HandleConnect)
+	session.AddHandler(metrics.HandleDisconnect)
 
+	// Register additional event handlers here as needed
+
+	// Start the background workers, which run until Shutdown
+	go d.audit.Run()
+	d.workers.Add(3)
+	go func() {
+		defer d.workers.Done()
+		d.processReactions()
+	}()
+	go func() {
+		defer d.workers.Done()
+		d.purgeLeftMembers()
+	}()
+	go func() {
+		defer d.workers.Done()
+		d.expireShopRoles()
+	}()
+
+	created = true
 	return d, nil
 }
 
-// Connect connects the Discord instance to the server
-func (d *Discord) Connect() error {
-	err := d.session.Open()
-	if err != nil {
-		return fmt.Errorf("failed to connect to Discord: %w", err)
-	}
-
-	log.Println("Bot is now running. Press CTRL-C to exit.")
+// CommandStats returns the usage counters of every command by name
+func (d *Discord) CommandStats() map[string]CommandStats {
+	return d.commands.Stats()
+}
 
-	// Wait for CTRL-C or SIGINT/SIGTERM
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-	<-signalChan
+// migrate applies the pending database migrations, or warns about them when auto_migrate is off
+func migrate(store *database.MongoStore, cfg *config.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
 
-	// Cleanly close down the Discord session
-	err = d.session.Close()
+	applied, err := store.Migrate(ctx, !cfg.AutoMigrate)
 	if err != nil {
-		logging.Error("Error closing Discord session:", err)
+		return fmt.Errorf("failed to migrate MongoDB: %w", err)
+	}
+	for _, migration := range applied {
+		if cfg.AutoMigrate {
+			logging.Info(fmt.Sprintf("Applied migration %d: %s", migration.Version, migration.Description))
+		} else {
+			logging.Warn(fmt.Sprintf("Migration %d is pending, run the migrate subcommand: %s", migration.Version, migration.Description))
+		}
 	}
-
 	return nil
 }
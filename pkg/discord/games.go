@@ -0,0 +1,354 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// gamesUsage explains the arguments of the !dapp command
+const gamesUsage = "Usage: `!dapp trivia`, `!dapp dice [@user]` or `!dapp guess`"
+
+// game is a minigame in progress, played by typing messages in the channel it started in
+type game interface {
+	// intro returns the message starting the game
+	intro() string
+	// play handles a message of one of the players. It returns the reply, empty to ignore
+	// the message, and the result once the game is over.
+	play(userID, content string) (string, *gameResult)
+	// expire returns the message sent and the result when the players did not answer in time
+	expire() (string, *gameResult)
+}
+
+// gameResult represents a finished game: every player records a play and the winners get the reward
+type gameResult struct {
+	players []*discordgo.User
+	winners []string // user IDs
+}
+
+// gameSession represents a game in progress and the players it waits for
+type gameSession struct {
+	name      string
+	game      game
+	channelID string
+	messageID string // command that started the game, which keys its play activities
+	players   []string
+	timer     *time.Timer
+}
+
+// Games runs the minigames started with !dapp. A user plays one game at a time, and the
+// messages they type in the channel of their game are its answers.
+type Games struct {
+	store  database.Store
+	cfg    *config.Config
+	ledger *Ledger
+	trivia *Trivia // question bank of the trivia game
+
+	mu       sync.Mutex
+	sessions map[string]*gameSession // by user ID
+	closed   bool                    // set by Close, after which no timer expires a game
+	workers  *sync.WaitGroup         // expiring games, waited for on shutdown
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+}
+
+// NewGames creates a new Games instance, asking the trivia questions of the bank of the host.
+// The games expiring when their timer fires are added to workers.
+func NewGames(store database.Store, cfg *config.Config, ledger *Ledger, host *Trivia, workers *sync.WaitGroup) *Games {
+	return &Games{
+		store:    store,
+		cfg:      cfg,
+		ledger:   ledger,
+		trivia:   host,
+		sessions: make(map[string]*gameSession),
+		workers:  workers,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// intn returns a random number in [0, n)
+func (g *Games) intn(n int) int {
+	g.rngMu.Lock()
+	defer g.rngMu.Unlock()
+	return g.rng.Intn(n)
+}
+
+// GamesCommand returns a command handler function for the !dapp command
+func GamesCommand(cfg *config.Config, games *Games) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleGames(s, m, args, cfg, games)
+	}
+}
+
+// gamesOptions returns the slash command options of the !dapp command
+func gamesOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "trivia",
+			Description: "Answer a trivia question",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "dice",
+			Description: "Roll the dice against the bot or another member",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionUser, Name: "opponent", Description: "The member to challenge, the bot when empty"},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "guess",
+			Description: "Guess the number the bot picked",
+		},
+	}
+}
+
+// handleGames handles the !dapp command, starting the chosen minigame
+func handleGames(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, games *Games) {
+	if len(args) == 0 {
+		reply(s, m, fmt.Sprintf("Let's play DappBot! Win a game for %d points. %s", cfg.Games.Reward, gamesUsage))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	players := []*discordgo.User{m.Author}
+	var newGame game
+	switch args[0] {
+	case "trivia":
+		var err error
+		newGame, err = games.newTrivia(m.Author)
+		if err != nil {
+			logging.Warn("Failed to pick a trivia question", err)
+			reply(s, m, "No trivia questions are loaded, please try another game.")
+			return
+		}
+	case "guess":
+		newGame = games.newGuess(m.Author)
+	case "dice":
+		if len(args) < 2 {
+			games.rollAgainstBot(ctx, s, m)
+			return
+		}
+		match := mentionPattern.FindStringSubmatch(args[1])
+		if match == nil {
+			reply(s, m, gamesUsage)
+			return
+		}
+		opponent, err := s.User(match[1])
+		if err != nil {
+			logging.Error("Failed to get opponent", err)
+			reply(s, m, "Failed to find that member.")
+			return
+		}
+		if opponent.Bot || opponent.ID == m.Author.ID {
+			reply(s, m, "Challenge another member, or leave the opponent out to play against the bot.")
+			return
+		}
+		players = append(players, opponent)
+		newGame = games.newDuel(m.Author, opponent)
+	default:
+		reply(s, m, gamesUsage)
+		return
+	}
+
+	for _, player := range players {
+		if reason := games.canPlay(ctx, player); reason != "" {
+			reply(s, m, reason)
+			return
+		}
+	}
+	intro, ok := games.start(s, m, args[0], newGame, players)
+	if !ok {
+		reply(s, m, fmt.Sprintf("<@%s> A game is already in progress, finish it first.", m.Author.ID))
+		return
+	}
+	reply(s, m, intro)
+}
+
+// canPlay returns why the user cannot start a game, or an empty string when they can
+func (g *Games) canPlay(ctx context.Context, user *discordgo.User) string {
+	g.mu.Lock()
+	_, playing := g.sessions[user.ID]
+	g.mu.Unlock()
+	if playing {
+		return fmt.Sprintf("<@%s> is already playing a game.", user.ID)
+	}
+
+	limit := g.cfg.Games.DailyLimit
+	if limit <= 0 {
+		return ""
+	}
+	today := startOfDay(time.Now(), g.cfg.Location())
+	played, err := g.store.CountActivities(ctx, database.ActivityFilter{
+		User:     user.ID,
+		Activity: database.ActivityPlay,
+		Since:    today,
+	})
+	if err != nil {
+		logging.Error("Failed to count games played", err)
+		return "Failed to check the games played today, please try again later."
+	}
+	if played >= limit {
+		tomorrow := today.AddDate(0, 0, 1)
+		return fmt.Sprintf("<@%s> has played %d games today, come back <t:%d:R>.", user.ID, limit, tomorrow.Unix())
+	}
+	return ""
+}
+
+// start opens a session for the game, unless one of the players is already playing.
+// It returns the message introducing the game.
+func (g *Games) start(s *discordgo.Session, m *discordgo.MessageCreate, name string, newGame game, players []*discordgo.User) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	session := &gameSession{
+		name:      name,
+		game:      newGame,
+		channelID: m.ChannelID,
+		messageID: m.ID,
+	}
+	for _, player := range players {
+		if _, playing := g.sessions[player.ID]; playing {
+			return "", false
+		}
+		session.players = append(session.players, player.ID)
+	}
+	for _, playerID := range session.players {
+		g.sessions[playerID] = session
+	}
+	session.timer = time.AfterFunc(g.cfg.Games.Timeout, func() {
+		g.mu.Lock()
+		if g.closed {
+			g.mu.Unlock()
+			return
+		}
+		g.workers.Add(1)
+		g.mu.Unlock()
+		defer g.workers.Done()
+		g.expire(s, session)
+	})
+
+	return newGame.intro() + fmt.Sprintf(" You have %s to answer.", g.cfg.Games.Timeout), true
+}
+
+// HandleMessage passes the messages of users who are playing a game in the channel to the game
+func (g *Games) HandleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author == nil || m.Author.Bot || strings.HasPrefix(m.Content, "!") {
+		return
+	}
+
+	g.mu.Lock()
+	session, ok := g.sessions[m.Author.ID]
+	if !ok || session.channelID != m.ChannelID {
+		g.mu.Unlock()
+		return
+	}
+	reply, result := session.game.play(m.Author.ID, strings.TrimSpace(m.Content))
+	if result != nil {
+		g.end(session)
+	} else if reply != "" {
+		session.timer.Reset(g.cfg.Games.Timeout)
+	}
+	g.mu.Unlock()
+
+	if reply == "" {
+		return
+	}
+	if result != nil {
+		reply += g.payout(s, session, result)
+	}
+	_, err := s.ChannelMessageSendReply(m.ChannelID, reply, m.Reference())
+	if err != nil {
+		logging.Error("Error sending message", err)
+	}
+}
+
+// expire ends the session when its players did not answer in time
+func (g *Games) expire(s *discordgo.Session, session *gameSession) {
+	g.mu.Lock()
+	if g.sessions[session.players[0]] != session {
+		g.mu.Unlock()
+		return
+	}
+	g.end(session)
+	message, result := session.game.expire()
+	g.mu.Unlock()
+
+	if result != nil {
+		message += g.payout(s, session, result)
+	}
+	_, err := s.ChannelMessageSend(session.channelID, message)
+	if err != nil {
+		logging.Error("Error sending message", err)
+	}
+}
+
+// end removes the session of its players. The caller must hold the lock.
+func (g *Games) end(session *gameSession) {
+	session.timer.Stop()
+	for _, playerID := range session.players {
+		if g.sessions[playerID] == session {
+			delete(g.sessions, playerID)
+		}
+	}
+}
+
+// Close ends the games in progress without recording them, when the bot shuts down.
+// The timers firing afterwards do nothing, so waiting for the workers waits for the games
+// that already expired.
+func (g *Games) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	for _, session := range g.sessions {
+		g.end(session)
+	}
+}
+
+// payout records a play activity for every player, with the reward for the winners,
+// and returns the text telling who won the points
+func (g *Games) payout(s *discordgo.Session, session *gameSession, result *gameResult) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	var text string
+	for _, player := range result.players {
+		reward := 0
+		if contains(result.winners, player.ID) {
+			reward = g.cfg.Games.Reward
+		}
+		_, err := g.ledger.Apply(ctx, s, &database.Activity{
+			User:      player.ID,
+			UserName:  player.Username,
+			ChannelId: session.channelID,
+			Activity:  database.ActivityPlay,
+			Reward:    reward,
+			MessageId: session.messageID,
+			Key:       activityKey(database.ActivityPlay, session.messageID, player.ID),
+			Game:      session.name,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil && err != database.ErrDuplicateActivity {
+			logging.Error("Failed to record game", err)
+			continue
+		}
+		if reward > 0 {
+			text += fmt.Sprintf(" <@%s> wins **%d** points!", player.ID, reward)
+		}
+	}
+	return text
+}
@@ -3,35 +3,81 @@ package discord
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/augustine0890/dapp-bot/internal/database"
 	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
 	"github.com/bwmarrin/discordgo"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // CommandHandlerFunc represents a function that handles a Discord command
 type CommandHandlerFunc func(s *discordgo.Session, m *discordgo.MessageCreate, args []string)
 
+// ComponentHandlerFunc represents a function that handles a click on a message component.
+// The args are the parts of the custom ID after its prefix, which are separated by ":".
+type ComponentHandlerFunc func(s *discordgo.Session, i *discordgo.InteractionCreate, args []string)
+
+// Command represents a command that can be invoked with the ! prefix and as a slash command
+type Command struct {
+	Name        string   // used for both the prefix and the slash command
+	Aliases     []string // additional names for the prefix command
+	Description string
+	Options     []*discordgo.ApplicationCommandOption // passed to the handler as args in declared order
+	Handler     CommandHandlerFunc
+
+	// Requirements to run the command, checked before the handler is called
+	Permissions int64    // Discord permission bits the user must all have in the channel
+	Roles       []string // role IDs of which the user must have at least one, empty for any
+	Channels    []string // channel IDs where the command can be used, empty for any
+	OwnerOnly   bool     // only the bot owners can use the command
+	Cooldown    Cooldown // overridden by the cooldowns in the config
+}
+
 // CommandHandler represents a handler for Discord commands
 type CommandHandler struct {
-	commands map[string]CommandHandlerFunc
+	commands  map[string]*Command
+	registry  []*Command
+	owners    []string // user IDs of the bot owners
+	cooldowns map[string]config.CooldownConfig
+	limiter   *rateLimiter
+	audit     *Auditor
+
+	components map[string]ComponentHandlerFunc // by custom ID prefix
 }
 
 // NewCommandHandler creates a new CommandHandler instance
-func NewCommandHandler() *CommandHandler {
+func NewCommandHandler(cfg *config.Config, audit *Auditor) *CommandHandler {
 	return &CommandHandler{
-		commands: make(map[string]CommandHandlerFunc),
+		commands:  make(map[string]*Command),
+		owners:    cfg.OwnerIDs,
+		cooldowns: cfg.Cooldowns,
+		limiter:   newRateLimiter(),
+		audit:     audit,
+
+		components: make(map[string]ComponentHandlerFunc),
 	}
 }
 
-// RegisterCommand registers one or more commands with the CommandHandler
-func (ch *CommandHandler) RegisterCommand(handler CommandHandlerFunc, names ...string) {
-	for _, name := range names {
-		ch.commands[name] = handler
+// RegisterCommand registers a command with the CommandHandler under its name and aliases
+func (ch *CommandHandler) RegisterCommand(cmd *Command) {
+	if override, ok := ch.cooldowns[cmd.Name]; ok {
+		cmd.Cooldown = Cooldown{User: override.User, Channel: override.Channel, Global: override.Global}
+	}
+	ch.registry = append(ch.registry, cmd)
+	ch.commands[cmd.Name] = cmd
+	for _, alias := range cmd.Aliases {
+		ch.commands[alias] = cmd
 	}
 }
 
+// RegisterComponent registers the handler of the message components whose custom ID starts with the prefix
+func (ch *CommandHandler) RegisterComponent(prefix string, handler ComponentHandlerFunc) {
+	ch.components[prefix] = handler
+}
+
 // HandleCommand handles incoming messages and triggers the corresponding command handlers
 func (ch *CommandHandler) HandleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 	// Ignore bot messages
@@ -45,9 +91,9 @@ func (ch *CommandHandler) HandleCommand(s *discordgo.Session, m *discordgo.Messa
 		// The message doesn't start with a command prefix
 		return
 	}
-	// Look up the handler function for the command
-	command := strings.TrimPrefix(parts[0], "!")
-	handler, ok := ch.commands[command]
+	// Look up the command
+	name := strings.TrimPrefix(parts[0], "!")
+	cmd, ok := ch.commands[name]
 	if !ok {
 		// Unknown command
 		return
@@ -55,76 +101,210 @@ func (ch *CommandHandler) HandleCommand(s *discordgo.Session, m *discordgo.Messa
 
 	// Call the handler function
 	args := parts[1:]
-	handler(s, m, args)
+	ch.run(s, m, cmd, args)
 }
 
-func RegisterHandler(session *discordgo.Session, mongoClient *mongo.Client, cfg *config.Config, eventType interface{}, handlerFunc interface{}) {
-	session.AddHandler(func(s *discordgo.Session, e interface{}) {
-		if reflect.TypeOf(e) == reflect.TypeOf(eventType) {
-			reflect.ValueOf(handlerFunc).Call([]reflect.Value{reflect.ValueOf(s), reflect.ValueOf(e), reflect.ValueOf(mongoClient), reflect.ValueOf(cfg)})
+// run calls the handler of the command when the user may run it and it is not cooling down
+func (ch *CommandHandler) run(s *discordgo.Session, m *discordgo.MessageCreate, cmd *Command, args []string) {
+	// Restricted commands are audited, including the attempts of users who may not run them
+	restricted := cmd.Permissions != 0 || len(cmd.Roles) > 0 || cmd.OwnerOnly
+	entry := database.AuditEntry{
+		Event:     database.AuditCommand,
+		ActorID:   m.Author.ID,
+		ChannelID: m.ChannelID,
+		Source:    "!" + cmd.Name,
+		Details:   strings.Join(args, " "),
+	}
+
+	if ok, reason := ch.checkAccess(s, m, cmd); !ok {
+		ch.limiter.deny(cmd)
+		if restricted {
+			entry.Event = database.AuditCommandDenied
+			ch.audit.Record(entry)
 		}
-	})
+		denyCommand(s, m, reason)
+		return
+	}
+	if wait, notify := ch.limiter.allow(cmd, m.Author.ID, m.ChannelID, time.Now()); wait > 0 {
+		if notify {
+			sendCooldown(s, m, wait)
+		}
+		return
+	}
+	if restricted {
+		ch.audit.Record(entry)
+	}
+	start := time.Now()
+	cmd.Handler(s, m, args)
+	ch.limiter.observe(cmd, time.Since(start))
 }
 
-func HandleReady(s *discordgo.Session, event *discordgo.Ready) {
-	targetGuild := "1019782712799805440"
+// Stats returns the counters of every command by name
+func (ch *CommandHandler) Stats() map[string]CommandStats {
+	return ch.limiter.snapshot()
+}
 
-	// Get the ID of the first server that the bot is connected to.
-	guilds := s.State.Guilds
-	if len(guilds) == 0 {
-		fmt.Println("Error: Bot is not connected to any servers.")
+// HandleInteraction handles slash commands by calling the handler of the matching command
+// with a message built from the interaction, so that commands are written once for both.
+func (ch *CommandHandler) HandleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionMessageComponent {
+		ch.handleComponent(s, i)
+		return
+	}
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	data := i.ApplicationCommandData()
+	cmd, ok := ch.commands[data.Name]
+	if !ok || cmd.Name != data.Name {
 		return
 	}
 
-	guildID := guilds[0].ID
-	if guildID != targetGuild {
+	// Acknowledge the interaction right away, the handler replies to it later
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logging.Error("Failed to acknowledge interaction", err)
 		return
 	}
 
-	// Fetch all the members of the server with the specified ID.
-	const batchSize = 1000
-	var members []*discordgo.Member
-	var lastMemberID string
-	for {
-		fetchedMembers, err := s.GuildMembers(guildID, lastMemberID, batchSize)
+	m := interactionMessage(i)
+	reply := &interactionReply{interaction: i.Interaction}
+	interactionReplies.Store(m.ID, reply)
+	defer interactionReplies.Delete(m.ID)
+
+	ch.run(s, m, cmd, optionArgs(cmd.Options, data.Options))
+
+	// Remove the "thinking" response when the handler did not reply
+	reply.mu.Lock()
+	defer reply.mu.Unlock()
+	if !reply.replied {
+		err := s.InteractionResponseDelete(i.Interaction)
 		if err != nil {
-			fmt.Println("Error: Could not fetch members", err)
-			return
+			logging.Error("Failed to delete interaction response", err)
 		}
-		members = append(members, fetchedMembers...)
+	}
+}
 
-		if len(fetchedMembers) < batchSize {
-			break
+// handleComponent calls the handler registered for the prefix of the custom ID of the clicked component
+func (ch *CommandHandler) handleComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	parts := strings.Split(i.MessageComponentData().CustomID, ":")
+	handler, ok := ch.components[parts[0]]
+	if !ok {
+		return
+	}
+	handler(s, i, parts[1:])
+}
+
+// componentID builds the custom ID of a message component from its prefix and args
+func componentID(prefix string, args ...string) string {
+	return strings.Join(append([]string{prefix}, args...), ":")
+}
+
+// RegisterApplicationCommands registers every command as a slash command in the guild,
+// replacing the whole set so that commands which are no longer registered are removed.
+func (ch *CommandHandler) RegisterApplicationCommands(s *discordgo.Session, guildID string) error {
+	appID := s.State.User.ID
+
+	existing, err := s.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return fmt.Errorf("failed to get application commands: %w", err)
+	}
+
+	commands := make([]*discordgo.ApplicationCommand, 0, len(ch.registry))
+	for _, cmd := range ch.registry {
+		command := &discordgo.ApplicationCommand{
+			Name:        cmd.Name,
+			Description: cmd.Description,
+			Options:     cmd.Options,
 		}
-		lastMemberID = fetchedMembers[len(fetchedMembers)-1].User.ID
+		// Hide the command from members who lack the permissions, they are still checked when run
+		if cmd.Permissions != 0 {
+			permissions := cmd.Permissions
+			command.DefaultMemberPermissions = &permissions
+		}
+		commands = append(commands, command)
 	}
 
-	fmt.Printf("Found %d members in server %s:\n", len(members), guilds[0].Name)
-	for _, member := range members {
-		// Skip this member if they are a bot.
-		if member.User.Bot {
-			fmt.Println("This member is a bot.")
-			continue
+	_, err = s.ApplicationCommandBulkOverwrite(appID, guildID, commands)
+	if err != nil {
+		return fmt.Errorf("failed to register application commands: %w", err)
+	}
+
+	for _, cmd := range existing {
+		if registered, ok := ch.commands[cmd.Name]; !ok || registered.Name != cmd.Name {
+			logging.Info(fmt.Sprintf("Removed stale application command /%s", cmd.Name))
 		}
-		// fmt.Printf("%s#%s (ID: %s)\n", member.User.Username, member.User.Discriminator, member.User.ID)
-		// fmt.Printf("Joined at: %s\n", member.JoinedAt.Format("2006-01-02 15:04:05"))
-		// fmt.Printf("Roles: %s\n", strings.Join(member.Roles, ", "))
-		// fmt.Println()
 	}
+	logging.Info(fmt.Sprintf("Registered %d application commands", len(commands)))
+
+	return nil
 }
 
-// HandlePing handles the !ping command and sends a response message
-func HandlePing(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	_, err := s.ChannelMessageSend(m.ChannelID, "Pong!")
-	if err != nil {
-		fmt.Println("Error handling !ping command:", err)
+// interactionMessage builds the message a prefix command would have received for the interaction
+func interactionMessage(i *discordgo.InteractionCreate) *discordgo.MessageCreate {
+	author := i.User
+	if i.Member != nil {
+		author = i.Member.User
+		i.Member.GuildID = i.GuildID
+	}
+	return &discordgo.MessageCreate{
+		Message: &discordgo.Message{
+			ID:        i.ID,
+			ChannelID: i.ChannelID,
+			GuildID:   i.GuildID,
+			Author:    author,
+			Member:    i.Member,
+			Timestamp: time.Now(),
+		},
 	}
 }
 
-// HandlePlayDapp handles the !dapp command and sends a response message
-func HandlePlayDapp(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
-	_, err := s.ChannelMessageSend(m.ChannelID, "Let's play DappBot!")
-	if err != nil {
-		fmt.Println("Error handling !dapp command:", err)
+// optionArgs turns the options of a slash command into the args of the prefix command,
+// in the order they are declared. Mentionable options are written as mentions.
+func optionArgs(declared []*discordgo.ApplicationCommandOption, given []*discordgo.ApplicationCommandInteractionDataOption) []string {
+	values := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(given))
+	for _, option := range given {
+		values[option.Name] = option
+	}
+
+	var args []string
+	for _, decl := range declared {
+		option, ok := values[decl.Name]
+		if !ok {
+			continue
+		}
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionSubCommand, discordgo.ApplicationCommandOptionSubCommandGroup:
+			args = append(args, option.Name)
+			args = append(args, optionArgs(decl.Options, option.Options)...)
+		case discordgo.ApplicationCommandOptionUser:
+			args = append(args, fmt.Sprintf("<@%v>", option.Value))
+		case discordgo.ApplicationCommandOptionChannel:
+			args = append(args, fmt.Sprintf("<#%v>", option.Value))
+		case discordgo.ApplicationCommandOptionRole:
+			args = append(args, fmt.Sprintf("<@&%v>", option.Value))
+		case discordgo.ApplicationCommandOptionInteger:
+			args = append(args, strconv.FormatInt(option.IntValue(), 10))
+		default:
+			args = append(args, strings.Fields(fmt.Sprint(option.Value))...)
+		}
 	}
+	return args
+}
+
+// RegisterHandler registers a handler function for the events of the given type, which is
+// called with the session, the event, the store and the config
+func (d *Discord) RegisterHandler(eventType interface{}, handlerFunc interface{}) {
+	d.session.AddHandler(track(d, func(s *discordgo.Session, e interface{}) {
+		if reflect.TypeOf(e) == reflect.TypeOf(eventType) {
+			reflect.ValueOf(handlerFunc).Call([]reflect.Value{reflect.ValueOf(s), reflect.ValueOf(e), reflect.ValueOf(d.store), reflect.ValueOf(d.cfg)})
+		}
+	}))
+}
+
+// HandlePing handles the !ping command and sends a response message
+func HandlePing(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	reply(s, m, "Pong!")
 }
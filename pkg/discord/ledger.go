@@ -0,0 +1,140 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/leveling"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Ledger changes the points of users only through activities, so that the points of
+// a user always add up to the rewards of their activities.
+type Ledger struct {
+	store   database.Store
+	cfg     *config.Config
+	curve   leveling.Curve
+	audit   *Auditor
+	metrics *Metrics
+}
+
+// NewLedger creates a new Ledger instance
+func NewLedger(store database.Store, cfg *config.Config, curve leveling.Curve, audit *Auditor, metrics *Metrics) *Ledger {
+	return &Ledger{
+		store:   store,
+		cfg:     cfg,
+		curve:   curve,
+		audit:   audit,
+		metrics: metrics,
+	}
+}
+
+// Apply records the activity and gives its reward to the user, announcing a level-up.
+// Activities without a reward, like lost games, are not audited.
+// Applying an activity with a key that was already applied returns database.ErrDuplicateActivity,
+// so retried Discord events never give points twice.
+func (l *Ledger) Apply(ctx context.Context, s *discordgo.Session, activity *database.Activity) (*database.User, error) {
+	user, err := l.store.ApplyActivity(ctx, activity)
+	if err != nil {
+		return nil, err
+	}
+	l.applied(s, activity, user)
+	return user, nil
+}
+
+// Debit records the activity, whose reward is negative, and takes its cost from the user only
+// when they have enough points, otherwise returning database.ErrInsufficientPoints
+func (l *Ledger) Debit(ctx context.Context, s *discordgo.Session, activity *database.Activity) (*database.User, error) {
+	user, err := l.store.ApplyDebit(ctx, activity)
+	if err != nil {
+		return nil, err
+	}
+	l.applied(s, activity, user)
+	return user, nil
+}
+
+// Adjust records the activity and adds its reward to the user only when they still have current
+// points, otherwise returning database.ErrPointsChanged
+func (l *Ledger) Adjust(ctx context.Context, s *discordgo.Session, activity *database.Activity, current int) (*database.User, error) {
+	user, err := l.store.ApplyAdjust(ctx, activity, current)
+	if err != nil {
+		return nil, err
+	}
+	l.applied(s, activity, user)
+	return user, nil
+}
+
+// applied audits an applied activity and announces the level-up it caused
+func (l *Ledger) applied(s *discordgo.Session, activity *database.Activity, user *database.User) {
+	if activity.Reward == 0 {
+		return
+	}
+	before, after := pointsChange(user.Points, activity.Reward)
+	l.audit.Record(database.AuditEntry{
+		Event:     database.AuditPoints,
+		UserID:    user.ID,
+		UserName:  user.UserName,
+		ActorID:   activity.Moderator,
+		ChannelID: activity.ChannelId,
+		Source:    activity.Activity,
+		Before:    before,
+		After:     after,
+		Details:   activity.Reason,
+	})
+	l.metrics.pointsAwarded(activity.Activity, activity.Reward)
+	if activity.Reward > 0 {
+		announceLevelUp(s, l.cfg, l.curve, user.ID, user.Points-activity.Reward, user.Points)
+	}
+}
+
+// Revert deletes an activity matching the filter and takes its reward back from the user.
+// A reward the user already spent is kept, returning database.ErrInsufficientPoints, and the
+// skipped revert is audited so an admin can settle it.
+func (l *Ledger) Revert(ctx context.Context, filter database.ActivityFilter) (*database.Activity, *database.User, error) {
+	activity, user, err := l.store.RevertActivity(ctx, filter)
+	if err == database.ErrInsufficientPoints {
+		l.revertSkipped(ctx, filter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	before, after := pointsChange(user.Points, -activity.Reward)
+	l.audit.Record(database.AuditEntry{
+		Event:     database.AuditPointsReverted,
+		UserID:    user.ID,
+		UserName:  user.UserName,
+		ChannelID: activity.ChannelId,
+		Source:    activity.Activity,
+		Before:    before,
+		After:     after,
+	})
+	return activity, user, nil
+}
+
+// revertSkipped audits the activity matching the filter whose reward could not be taken back
+func (l *Ledger) revertSkipped(ctx context.Context, filter database.ActivityFilter) {
+	activities, err := l.store.ListActivities(ctx, filter, 0, 1)
+	if err != nil || len(activities) == 0 {
+		logging.Warn("Failed to find the activity of a skipped revert", err)
+		return
+	}
+	activity := activities[0]
+	l.audit.Record(database.AuditEntry{
+		Event:     database.AuditRevertSkipped,
+		UserID:    activity.User,
+		UserName:  activity.UserName,
+		ChannelID: activity.ChannelId,
+		Source:    activity.Activity,
+		Details:   fmt.Sprintf("Kept the %d points of %s, the user no longer has them", activity.Reward, activity.Key),
+	})
+}
+
+// activityKey builds the idempotency key of an activity from the values identifying it
+func activityKey(parts ...string) string {
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,46 @@
+package discord
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/leveling"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// announceLevelUp announces when a change of points takes the user to a higher level
+// and gives the user the roles rewarded for the levels reached.
+func announceLevelUp(s *discordgo.Session, cfg *config.Config, curve leveling.Curve, userID string, before, after int) {
+	from := leveling.GetProgress(curve, before).Level
+	to := leveling.GetProgress(curve, after).Level
+	if to <= from {
+		return
+	}
+
+	for _, reward := range cfg.Leveling.RoleRewards {
+		if reward.Level <= from || reward.Level > to {
+			continue
+		}
+		err := s.GuildMemberRoleAdd(cfg.GuildID, userID, reward.RoleID)
+		if err != nil {
+			logging.Error(fmt.Sprintf("Failed to add level %d role", reward.Level), err)
+		}
+	}
+
+	channelID := cfg.Leveling.AnnounceChannelID
+	if channelID == "" {
+		return
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       "Level Up! 🎉",
+		Description: fmt.Sprintf("<@%s> reached **level %d**!", userID, to),
+		Color:       0x00aaff,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+	_, err := s.ChannelMessageSendEmbed(channelID, embed)
+	if err != nil {
+		logging.Error("Error sending level up message", err)
+	}
+}
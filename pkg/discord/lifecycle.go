@@ -0,0 +1,170 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// finalStepTimeout is how long recording the audit entries and disconnecting from MongoDB
+// may each take on shutdown, even when the shutdown deadline already passed
+const finalStepTimeout = 5 * time.Second
+
+// handlerGroup keeps track of the event handlers in flight, so that shutting down can wait for them
+type handlerGroup struct {
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// begin reports whether a handler may start, and counts it as in flight when it may
+func (g *handlerGroup) begin() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// end marks a handler started with begin as finished
+func (g *handlerGroup) end() {
+	g.wg.Done()
+}
+
+// close stops new handlers from starting
+func (g *handlerGroup) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+}
+
+// wait waits until the handlers in flight finished, or ctx is done
+func (g *handlerGroup) wait(ctx context.Context) error {
+	return waitGroup(ctx, &g.wg)
+}
+
+// track wraps an event handler so that it is counted as in flight while it runs,
+// and skipped once the bot is shutting down
+func track[E any](d *Discord, handler func(*discordgo.Session, E)) func(*discordgo.Session, E) {
+	return func(s *discordgo.Session, e E) {
+		if !d.handlers.begin() {
+			return
+		}
+		defer d.handlers.end()
+		handler(s, e)
+	}
+}
+
+// waitGroup waits until the wait group is done, or ctx is done
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run connects the bot to Discord and handles events until ctx is done.
+// It does not stop the bot, Shutdown must be called once it returns.
+func (d *Discord) Run(ctx context.Context) error {
+	// Serve the health endpoints first, so that the bot reports not ready while connecting
+	if d.httpServer != nil {
+		err := d.serveHTTP()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := d.session.Open()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Discord: %w", err)
+	}
+
+	// Register the slash commands once the bot user is known
+	err = d.commands.RegisterApplicationCommands(d.session, d.cfg.GuildID)
+	if err != nil {
+		logging.Error("Failed to register slash commands", err)
+	}
+
+	logging.Info("Bot is now running")
+	<-ctx.Done()
+	logging.Info("Bot is shutting down")
+	return nil
+}
+
+// Shutdown stops the bot. It stops handling events, waits for the handlers in flight and the
+// workers until ctx is done, then records the queued audit entries and disconnects from MongoDB
+// within finalStepTimeout each.
+// Calling it again returns the result of the first call.
+func (d *Discord) Shutdown(ctx context.Context) error {
+	d.shutdownOnce.Do(func() {
+		d.shutdownErr = d.shutdown(ctx)
+	})
+	return d.shutdownErr
+}
+
+func (d *Discord) shutdown(ctx context.Context) error {
+	var failures []string
+	fail := func(step string, err error) {
+		logging.Error("Failed to "+step, err)
+		failures = append(failures, fmt.Sprintf("failed to %s: %v", step, err))
+	}
+
+	// Skip the events still arriving, then close the connection so that no more arrive
+	d.handlers.close()
+	if d.httpServer != nil {
+		if err := d.httpServer.Shutdown(ctx); err != nil {
+			fail("stop HTTP server", err)
+		}
+	}
+	if err := d.session.Close(); err != nil {
+		fail("close Discord session", err)
+	}
+
+	// The reaction queue can only be closed once no handler is left to send to it. When
+	// handlers are still in flight, closing stop releases the reaction worker instead.
+	if err := d.handlers.wait(ctx); err != nil {
+		fail("wait for event handlers", err)
+	} else {
+		close(d.reactionCh)
+	}
+	close(d.stop)
+	d.games.Close()
+	d.trivia.Close()
+	if err := waitGroup(ctx, d.workers); err != nil {
+		fail("wait for workers", err)
+	}
+
+	// The audit entries and the disconnect get their own time, as ctx may be done by now
+	flushCtx, cancel := context.WithTimeout(context.Background(), finalStepTimeout)
+	defer cancel()
+	if err := d.audit.Close(flushCtx); err != nil {
+		fail("record audit entries", err)
+	}
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), finalStepTimeout)
+	defer cancel()
+	if err := d.mongoClient.Disconnect(disconnectCtx); err != nil {
+		fail("disconnect from MongoDB", err)
+	}
+	logging.Flush()
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
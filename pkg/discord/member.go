@@ -9,11 +9,17 @@ import (
 	"github.com/augustine0890/dapp-bot/pkg/config"
 	"github.com/augustine0890/dapp-bot/pkg/logging"
 	"github.com/bwmarrin/discordgo"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func HandleMember(s *discordgo.Session, e interface{}, mongoClient *mongo.Client, cfg *config.Config) {
+// MemberHandler returns a handler function for the member join and leave events
+func MemberHandler(audit *Auditor) func(s *discordgo.Session, e interface{}, store database.Store, cfg *config.Config) {
+	return func(s *discordgo.Session, e interface{}, store database.Store, cfg *config.Config) {
+		handleMember(s, e, store, cfg, audit)
+	}
+}
+
+// handleMember creates the user when a member joins the guild and marks them as left when they leave
+func handleMember(s *discordgo.Session, e interface{}, store database.Store, cfg *config.Config, audit *Auditor) {
 	var userID string
 	var username string
 	var joinedDate time.Time
@@ -41,37 +47,40 @@ func HandleMember(s *discordgo.Session, e interface{}, mongoClient *mongo.Client
 		return
 	}
 
-	usersColl := database.GetUsersColl(mongoClient, cfg)
-	ctx := context.TODO()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
 	if leave {
-		// Delete user from users collection
-		filter := bson.M{"_id": userID}
-		_, err := usersColl.DeleteOne(ctx, filter)
-		if err != nil {
-			logging.Warn("Failed to delete user document", err)
-		}
-
-		// Delete user's activities from activities collection
-		activitiesColl := database.GetActivitiesColl(mongoClient, cfg)
-		_, err = activitiesColl.DeleteMany(ctx, bson.M{"user": userID})
-		if err != nil {
-			logging.Warn("Failed to delete activity documents for user", err)
+		// Keep the user and their activities, so that they are restored when rejoining
+		err := store.MarkLeft(ctx, userID, time.Now().UTC())
+		if err != nil && err != database.ErrNotFound {
+			logging.Warn("Failed to mark user as left", err)
 		}
+		audit.Record(database.AuditEntry{
+			Event:    database.AuditMemberLeave,
+			UserID:   userID,
+			UserName: username,
+		})
 
 	} else {
-		user := &database.User{
-			ID:         userID,
-			UserName:   username,
-			Points:     0,
-			JoinedDate: joinedDate,
-			CreatedAt:  time.Now().UTC(),
-			UpdatedAt:  time.Now().UTC(),
-		}
-		_, err := usersColl.InsertOne(ctx, user)
+		rejoined, err := joinUser(ctx, store, cfg, userID, username, joinedDate)
 		if err != nil {
 			logging.Warn("Failed to insert user document", err)
 		}
+		details := "New member"
+		if rejoined {
+			details = "Rejoined, rejoin policy " + cfg.Members.RejoinPolicy
+		}
+		audit.Record(database.AuditEntry{
+			Event:    database.AuditMemberJoin,
+			UserID:   userID,
+			UserName: username,
+			Details:  details,
+		})
+		if rejoined {
+			// Returning members already got the welcome message
+			return
+		}
 
 		// Send a DM to the new member with the long text
 		dm, err := s.UserChannelCreate(userID)
@@ -113,3 +122,70 @@ func HandleMember(s *discordgo.Session, e interface{}, mongoClient *mongo.Client
 		}
 	}
 }
+
+// joinUser creates the user of a new member, or restores or resets the user of a member
+// who rejoins according to the rejoin policy. It reports whether the user already existed.
+func joinUser(ctx context.Context, store database.Store, cfg *config.Config, userID, username string, joinedDate time.Time) (bool, error) {
+	existing, err := store.GetUser(ctx, userID)
+	if err != nil && err != database.ErrNotFound {
+		return false, err
+	}
+	if existing != nil {
+		if existing.Active() {
+			return true, nil
+		}
+		if cfg.Members.RejoinPolicy != config.RejoinReset {
+			return true, store.RestoreUser(ctx, userID, username)
+		}
+		// Start over, deleting the points and activities from before leaving
+		if err := store.DeleteActivities(ctx, userID); err != nil {
+			return true, err
+		}
+		if err := store.DeleteUser(ctx, userID); err != nil {
+			return true, err
+		}
+	}
+
+	user := &database.User{
+		ID:         userID,
+		UserName:   username,
+		Points:     0,
+		JoinedDate: joinedDate,
+		CreatedAt:  time.Now().UTC(),
+		UpdatedAt:  time.Now().UTC(),
+	}
+	return existing != nil, store.CreateUser(ctx, user)
+}
+
+// purgeLeftMembers deletes the data of members who left longer ago than the retention window, once a day,
+// until the bot shuts down
+func (d *Discord) purgeLeftMembers() {
+	retention := d.cfg.Members.LeftRetentionDays
+	if retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		before := time.Now().UTC().AddDate(0, 0, -retention)
+		purged, err := database.PurgeLeftUsers(ctx, d.store, before)
+		cancel()
+		if err != nil {
+			logging.Error("Failed to purge members who left", err)
+		} else if purged > 0 {
+			details := fmt.Sprintf("Purged %d members who left before %s", purged, before.Format(time.RFC3339))
+			logging.Info(details)
+			d.audit.Record(database.AuditEntry{
+				Event:   database.AuditMembersPurged,
+				Details: details,
+			})
+		}
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package discord
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Metrics counts what the bot does besides running commands, for monitoring
+type Metrics struct {
+	mu     sync.Mutex
+	points map[string]int64 // points awarded by activity type
+
+	reactionsRemoved atomic.Uint64
+	connects         atomic.Uint64 // gateway connections, the first one included
+	connected        atomic.Bool
+}
+
+// NewMetrics creates a new Metrics instance
+func NewMetrics() *Metrics {
+	return &Metrics{points: make(map[string]int64)}
+}
+
+// pointsAwarded counts the reward of an applied activity, when it gave points
+func (m *Metrics) pointsAwarded(activity string, reward int) {
+	if m == nil || reward <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.points[activity] += int64(reward)
+}
+
+// reactionRemoved counts a blocked reaction removed from a message
+func (m *Metrics) reactionRemoved() {
+	if m == nil {
+		return
+	}
+	m.reactionsRemoved.Add(1)
+}
+
+// HandleConnect counts the connections to the gateway, to tell how often the bot reconnects
+func (m *Metrics) HandleConnect(s *discordgo.Session, c *discordgo.Connect) {
+	m.connects.Add(1)
+	m.connected.Store(true)
+}
+
+// HandleDisconnect marks the gateway as disconnected until the bot reconnects
+func (m *Metrics) HandleDisconnect(s *discordgo.Session, d *discordgo.Disconnect) {
+	m.connected.Store(false)
+}
+
+// reconnects returns the number of gateway connections after the first one
+func (m *Metrics) reconnects() uint64 {
+	connects := m.connects.Load()
+	if connects == 0 {
+		return 0
+	}
+	return connects - 1
+}
+
+// writeMetrics writes the command counters and the metrics in the Prometheus text format
+func writeMetrics(w io.Writer, commands map[string]CommandStats, m *Metrics) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP dappbot_commands_total Commands received, by command and result.")
+	fmt.Fprintln(w, "# TYPE dappbot_commands_total counter")
+	for _, name := range names {
+		stats := commands[name]
+		fmt.Fprintf(w, "dappbot_commands_total{command=%q,result=\"invoked\"} %d\n", name, stats.Invoked)
+		fmt.Fprintf(w, "dappbot_commands_total{command=%q,result=\"denied\"} %d\n", name, stats.Denied)
+		fmt.Fprintf(w, "dappbot_commands_total{command=%q,result=\"rate_limited\"} %d\n", name, stats.RateLimited)
+	}
+
+	fmt.Fprintln(w, "# HELP dappbot_command_duration_seconds Time spent in command handlers.")
+	fmt.Fprintln(w, "# TYPE dappbot_command_duration_seconds histogram")
+	for _, name := range names {
+		stats := commands[name]
+		var count uint64
+		for i, bound := range latencyBuckets {
+			count += stats.Latency[i]
+			le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+			fmt.Fprintf(w, "dappbot_command_duration_seconds_bucket{command=%q,le=%q} %d\n", name, le, count)
+		}
+		fmt.Fprintf(w, "dappbot_command_duration_seconds_bucket{command=%q,le=\"+Inf\"} %d\n", name, stats.Invoked)
+		fmt.Fprintf(w, "dappbot_command_duration_seconds_sum{command=%q} %g\n", name, stats.Duration.Seconds())
+		fmt.Fprintf(w, "dappbot_command_duration_seconds_count{command=%q} %d\n", name, stats.Invoked)
+	}
+
+	m.mu.Lock()
+	activities := make([]string, 0, len(m.points))
+	for activity := range m.points {
+		activities = append(activities, activity)
+	}
+	sort.Strings(activities)
+	fmt.Fprintln(w, "# HELP dappbot_points_awarded_total Points given to users, by activity.")
+	fmt.Fprintln(w, "# TYPE dappbot_points_awarded_total counter")
+	for _, activity := range activities {
+		fmt.Fprintf(w, "dappbot_points_awarded_total{activity=%q} %d\n", activity, m.points[activity])
+	}
+	m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP dappbot_reactions_removed_total Blocked reactions removed from messages.")
+	fmt.Fprintln(w, "# TYPE dappbot_reactions_removed_total counter")
+	fmt.Fprintf(w, "dappbot_reactions_removed_total %d\n", m.reactionsRemoved.Load())
+
+	fmt.Fprintln(w, "# HELP dappbot_gateway_reconnects_total Connections to the Discord gateway after the first one.")
+	fmt.Fprintln(w, "# TYPE dappbot_gateway_reconnects_total counter")
+	fmt.Fprintf(w, "dappbot_gateway_reconnects_total %d\n", m.reconnects())
+
+	connected := 0
+	if m.connected.Load() {
+		connected = 1
+	}
+	fmt.Fprintln(w, "# HELP dappbot_gateway_connected Whether the bot is connected to the Discord gateway.")
+	fmt.Fprintln(w, "# TYPE dappbot_gateway_connected gauge")
+	fmt.Fprintf(w, "dappbot_gateway_connected %d\n", connected)
+}
@@ -0,0 +1,180 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/augustine0890/dapp-bot/pkg/trivia"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Bounds of the number guessing game
+const (
+	guessMax      = 100
+	guessAttempts = 7
+)
+
+// triviaGame asks the player one question of the trivia bank, which they answer once
+type triviaGame struct {
+	player   *discordgo.User
+	question trivia.Question
+}
+
+// newTrivia starts a trivia game with a random question of the bank loaded for !trivia,
+// or returns an error when no bank is loaded
+func (g *Games) newTrivia(player *discordgo.User) (game, error) {
+	bank := g.trivia.questionBank()
+	if bank == nil {
+		return nil, trivia.ErrNoQuestions
+	}
+	g.rngMu.Lock()
+	questions, err := bank.Pick("", 1, g.rng)
+	g.rngMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &triviaGame{player: player, question: questions[0]}, nil
+}
+
+func (t *triviaGame) intro() string {
+	intro := fmt.Sprintf("<@%s> ❓ %s", t.player.ID, t.question.Text)
+	if len(t.question.Choices) > 0 {
+		intro += fmt.Sprintf(" (%s)", strings.Join(t.question.Choices, " / "))
+	}
+	return intro
+}
+
+func (t *triviaGame) play(userID, content string) (string, *gameResult) {
+	result := &gameResult{players: []*discordgo.User{t.player}}
+	if t.question.Correct(content) {
+		result.winners = []string{t.player.ID}
+		return "✅ Correct!", result
+	}
+	return fmt.Sprintf("❌ Wrong, the answer was **%s**.", t.question.Answer), result
+}
+
+func (t *triviaGame) expire() (string, *gameResult) {
+	return fmt.Sprintf("<@%s> ⏰ Time's up, the answer was **%s**.", t.player.ID, t.question.Answer),
+		&gameResult{players: []*discordgo.User{t.player}}
+}
+
+// guessGame lets the player guess a number, telling them whether it is higher or lower
+type guessGame struct {
+	player   *discordgo.User
+	number   int
+	attempts int
+}
+
+// newGuess starts a number guessing game with a random number
+func (g *Games) newGuess(player *discordgo.User) game {
+	return &guessGame{player: player, number: g.intn(guessMax) + 1}
+}
+
+func (n *guessGame) intro() string {
+	return fmt.Sprintf("<@%s> 🔢 I picked a number between 1 and %d, you have %d guesses.", n.player.ID, guessMax, guessAttempts)
+}
+
+func (n *guessGame) play(userID, content string) (string, *gameResult) {
+	guess, err := strconv.Atoi(content)
+	if err != nil || guess < 1 || guess > guessMax {
+		return "", nil
+	}
+
+	n.attempts++
+	result := &gameResult{players: []*discordgo.User{n.player}}
+	if guess == n.number {
+		result.winners = []string{n.player.ID}
+		return fmt.Sprintf("🎉 %d is right, found in %d guesses!", n.number, n.attempts), result
+	}
+	if n.attempts >= guessAttempts {
+		return fmt.Sprintf("❌ Out of guesses, the number was **%d**.", n.number), result
+	}
+
+	hint := "higher"
+	if guess > n.number {
+		hint = "lower"
+	}
+	return fmt.Sprintf("It's %s than %d, %d guesses left.", hint, guess, guessAttempts-n.attempts), nil
+}
+
+func (n *guessGame) expire() (string, *gameResult) {
+	return fmt.Sprintf("<@%s> ⏰ Time's up, the number was **%d**.", n.player.ID, n.number),
+		&gameResult{players: []*discordgo.User{n.player}}
+}
+
+// duelGame is a dice duel between two members, which starts once the opponent accepts
+type duelGame struct {
+	games      *Games
+	challenger *discordgo.User
+	opponent   *discordgo.User
+}
+
+// newDuel challenges the opponent to a dice duel
+func (g *Games) newDuel(challenger, opponent *discordgo.User) game {
+	return &duelGame{games: g, challenger: challenger, opponent: opponent}
+}
+
+func (d *duelGame) intro() string {
+	return fmt.Sprintf("<@%s> 🎲 <@%s> challenges you to a dice duel! Type `accept` or `decline`.", d.opponent.ID, d.challenger.ID)
+}
+
+func (d *duelGame) play(userID, content string) (string, *gameResult) {
+	if userID != d.opponent.ID {
+		return "", nil
+	}
+	switch strings.ToLower(content) {
+	case "accept":
+		return d.games.rollDice(d.challenger, d.opponent)
+	case "decline":
+		// A declined duel was not played, nobody records a play
+		return fmt.Sprintf("<@%s> declined the duel.", d.opponent.ID), &gameResult{}
+	}
+	return "", nil
+}
+
+func (d *duelGame) expire() (string, *gameResult) {
+	return fmt.Sprintf("<@%s> ⏰ The duel was not accepted in time.", d.challenger.ID), &gameResult{}
+}
+
+// rollDice rolls two dice for each player, the highest total wins and nobody wins a tie
+func (g *Games) rollDice(first, second *discordgo.User) (string, *gameResult) {
+	roll := func() (int, int) {
+		return g.intn(6) + 1, g.intn(6) + 1
+	}
+	a1, a2 := roll()
+	b1, b2 := roll()
+	firstName, secondName := "<@"+first.ID+">", "<@"+second.ID+">"
+	if second.Bot {
+		secondName = "I"
+	}
+
+	text := fmt.Sprintf("🎲 %s rolled %d + %d = **%d**, %s rolled %d + %d = **%d**.", firstName, a1, a2, a1+a2, secondName, b1, b2, b1+b2)
+	result := &gameResult{}
+	for _, player := range []*discordgo.User{first, second} {
+		if !player.Bot {
+			result.players = append(result.players, player)
+		}
+	}
+	switch {
+	case a1+a2 > b1+b2:
+		result.winners = []string{first.ID}
+	case a1+a2 < b1+b2:
+		result.winners = []string{second.ID}
+	default:
+		text += " It's a tie!"
+	}
+	return text, result
+}
+
+// rollAgainstBot plays a dice duel against the bot right away
+func (g *Games) rollAgainstBot(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate) {
+	if reason := g.canPlay(ctx, m.Author); reason != "" {
+		reply(s, m, reason)
+		return
+	}
+	text, result := g.rollDice(m.Author, s.State.User)
+	session := &gameSession{name: "dice", channelID: m.ChannelID, messageID: m.ID}
+	reply(s, m, text+g.payout(s, session, result))
+}
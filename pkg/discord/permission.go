@@ -0,0 +1,84 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// adminOnly restricts the command to the admin roles, or to administrators when no admin role is configured
+func adminOnly(cfg *config.Config, cmd *Command) *Command {
+	if len(cfg.AdminRoleIDs) > 0 {
+		cmd.Roles = cfg.AdminRoleIDs
+	} else {
+		cmd.Permissions = discordgo.PermissionAdministrator
+	}
+	return cmd
+}
+
+// checkAccess reports whether the author of the message may run the command. When they may
+// not, it returns the reason to show them. Owners skip the permission and role requirements
+// but are still held to the channels of the command.
+func (ch *CommandHandler) checkAccess(s *discordgo.Session, m *discordgo.MessageCreate, cmd *Command) (bool, string) {
+	if len(cmd.Channels) > 0 && !contains(cmd.Channels, m.ChannelID) {
+		mentions := make([]string, len(cmd.Channels))
+		for i, channelID := range cmd.Channels {
+			mentions[i] = fmt.Sprintf("<#%s>", channelID)
+		}
+		return false, fmt.Sprintf("Please go to the %s channel to use this command.", strings.Join(mentions, " or "))
+	}
+
+	owner := contains(ch.owners, m.Author.ID)
+	if cmd.OwnerOnly && !owner {
+		return false, "Only the bot owners can use this command."
+	}
+	if owner {
+		return true, ""
+	}
+
+	if cmd.Permissions != 0 {
+		perms, err := s.UserChannelPermissions(m.Author.ID, m.ChannelID)
+		if err != nil {
+			logging.Error("Failed to get user permissions", err)
+			return false, "You do not have permission to use this command."
+		}
+		if perms&cmd.Permissions != cmd.Permissions {
+			return false, "You do not have permission to use this command."
+		}
+	}
+
+	if len(cmd.Roles) > 0 && !hasAnyRole(s, m, cmd.Roles) {
+		return false, "You do not have the role needed to use this command."
+	}
+	return true, ""
+}
+
+// hasAnyRole reports whether the author of the message has at least one of the roles
+func hasAnyRole(s *discordgo.Session, m *discordgo.MessageCreate, roles []string) bool {
+	member := m.Member
+	if member == nil || member.Roles == nil {
+		if m.GuildID == "" {
+			return false
+		}
+		var err error
+		member, err = s.GuildMember(m.GuildID, m.Author.ID)
+		if err != nil {
+			logging.Error("Failed to get guild member", err)
+			return false
+		}
+	}
+	for _, roleID := range member.Roles {
+		if contains(roles, roleID) {
+			return true
+		}
+	}
+	return false
+}
+
+// denyCommand tells the author of the message why they cannot run the command
+func denyCommand(s *discordgo.Session, m *discordgo.MessageCreate, reason string) {
+	reply(s, m, fmt.Sprintf("<@%s> %s", m.Author.ID, reason))
+}
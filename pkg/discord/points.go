@@ -0,0 +1,272 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// historyPageSize is the number of activities shown per page of !points history
+const historyPageSize = 10
+
+// pointsUsage explains the arguments of the !points command
+const pointsUsage = "Usage: `!points give|take|set @user <points> <reason>` or `!points history @user [page]`"
+
+// mentionPattern matches a user mention and captures the user ID
+var mentionPattern = regexp.MustCompile(`^<@!?(\d+)>$`)
+
+// PointsCommand returns a command handler function for the !points command
+func PointsCommand(cfg *config.Config, store database.Store, ledger *Ledger) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handlePoints(s, m, args, cfg, store, ledger)
+	}
+}
+
+// pointsOptions returns the slash command options of the !points command
+func pointsOptions() []*discordgo.ApplicationCommandOption {
+	adjust := func(name, description string) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        name,
+			Description: description,
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "The member", Required: true},
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "points", Description: "The number of points", Required: true},
+				{Type: discordgo.ApplicationCommandOptionString, Name: "reason", Description: "Why the points change", Required: true},
+			},
+		}
+	}
+	return []*discordgo.ApplicationCommandOption{
+		adjust("give", "Give points to a member"),
+		adjust("take", "Take points from a member"),
+		adjust("set", "Set the points of a member"),
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "history",
+			Description: "Show the point history of a member",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Description: "The member", Required: true},
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "page", Description: "The page to show"},
+			},
+		},
+	}
+}
+
+// handlePoints handles the !points command, letting admins change the points of a member
+// or page through their activities
+func handlePoints(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, store database.Store, ledger *Ledger) {
+	if len(args) < 2 {
+		reply(s, m, pointsUsage)
+		return
+	}
+	userID, ok := parseMention(args[1])
+	if !ok {
+		reply(s, m, pointsUsage)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "give", "take", "set":
+		if len(args) < 4 {
+			reply(s, m, pointsUsage)
+			return
+		}
+		points, err := strconv.Atoi(args[2])
+		if err != nil || points < 0 {
+			reply(s, m, "The points must be a positive number.")
+			return
+		}
+		adjustPoints(ctx, s, m, args[0], userID, points, strings.Join(args[3:], " "), store, ledger)
+	case "history":
+		page := 1
+		if len(args) > 2 {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < 1 {
+				reply(s, m, "The page must be a number from 1.")
+				return
+			}
+			page = n
+		}
+		showHistory(ctx, s, m, userID, page, store)
+	default:
+		reply(s, m, pointsUsage)
+	}
+}
+
+// adjustAttempts is the number of times the points of a user are set when they change
+// between reading them and setting them
+const adjustAttempts = 3
+
+// adjustPoints gives, takes or sets the points of the user through an adjust activity
+// recording the moderator and the reason. Setting the points only applies when they did not
+// change since they were read, and is tried again otherwise, so the user ends at exactly the
+// points set.
+func adjustPoints(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, action, userID string, points int, reason string, store database.Store, ledger *Ledger) {
+	for attempt := 0; attempt < adjustAttempts; attempt++ {
+		userName, current, ok := currentPoints(ctx, s, m, userID, store)
+		if !ok {
+			return
+		}
+
+		reward := points
+		switch action {
+		case "take":
+			if points > current {
+				reply(s, m, fmt.Sprintf("<@%s> only has %d points.", userID, current))
+				return
+			}
+			reward = -points
+		case "set":
+			reward = points - current
+		}
+		if reward == 0 {
+			reply(s, m, fmt.Sprintf("<@%s> already has %d points.", userID, current))
+			return
+		}
+
+		now := time.Now().UTC()
+		activity := &database.Activity{
+			User:      userID,
+			UserName:  userName,
+			ChannelId: m.ChannelID,
+			Activity:  database.ActivityAdjust,
+			Reward:    reward,
+			MessageId: m.ID,
+			Key:       activityKey(database.ActivityAdjust, m.ID),
+			Moderator: m.Author.ID,
+			Reason:    reason,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		// Points are taken with a conditional debit, so that concurrent changes never take them below zero
+		var updated *database.User
+		var err error
+		switch {
+		case action == "set":
+			updated, err = ledger.Adjust(ctx, s, activity, current)
+		case reward < 0:
+			updated, err = ledger.Debit(ctx, s, activity)
+		default:
+			updated, err = ledger.Apply(ctx, s, activity)
+		}
+		switch {
+		case err == database.ErrPointsChanged:
+			continue
+		case err == database.ErrDuplicateActivity:
+			return
+		case err == database.ErrInsufficientPoints:
+			reply(s, m, fmt.Sprintf("<@%s> no longer has %d points.", userID, -reward))
+			return
+		case err != nil:
+			logging.Error("Failed to adjust user points", err)
+			reply(s, m, "Failed to change the points, please check the logs.")
+			return
+		}
+
+		embed := &discordgo.MessageEmbed{
+			Title:       "Points Changed",
+			Description: fmt.Sprintf("<@%s> %+d points", userID, reward),
+			Footer: &discordgo.MessageEmbedFooter{
+				Text:    fmt.Sprintf("Changed by %s#%s", m.Author.Username, m.Author.Discriminator),
+				IconURL: m.Author.AvatarURL(""),
+			},
+			Color:     0x00aaff,
+			Timestamp: now.Format(time.RFC3339),
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "Points", Value: fmt.Sprintf("%d → %d", updated.Points-reward, updated.Points), Inline: true},
+				{Name: "Reason", Value: reason, Inline: true},
+			},
+		}
+		sendEmbed(s, m, embed)
+		return
+	}
+	reply(s, m, fmt.Sprintf("The points of <@%s> kept changing, please try again.", userID))
+}
+
+// currentPoints returns the name and the points of the user, who has no points when they
+// are not in the database yet. It reports false when the user could not be read.
+func currentPoints(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, userID string, store database.Store) (string, int, bool) {
+	user, err := store.GetUser(ctx, userID)
+	switch {
+	case err == nil:
+		return user.UserName, user.Points, true
+	case err == database.ErrNotFound:
+		discordUser, err := s.User(userID)
+		if err != nil {
+			logging.Error("Failed to get Discord user", err)
+			reply(s, m, "Could not find that member.")
+			return "", 0, false
+		}
+		return discordUser.Username, 0, true
+	default:
+		logging.Error("Failed retrieving user points", err)
+		return "", 0, false
+	}
+}
+
+// showHistory sends a page of the activities of the user, newest first
+func showHistory(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, userID string, page int, store database.Store) {
+	filter := database.ActivityFilter{User: userID}
+	total, err := store.CountActivities(ctx, filter)
+	if err != nil {
+		logging.Error("Failed to count user activities", err)
+		return
+	}
+	pages := (total + historyPageSize - 1) / historyPageSize
+	if pages == 0 {
+		reply(s, m, fmt.Sprintf("<@%s> has no activities yet.", userID))
+		return
+	}
+	if page > pages {
+		page = pages
+	}
+
+	activities, err := store.ListActivities(ctx, filter, (page-1)*historyPageSize, historyPageSize)
+	if err != nil {
+		logging.Error("Failed to list user activities", err)
+		return
+	}
+
+	lines := make([]string, 0, len(activities))
+	for _, activity := range activities {
+		line := fmt.Sprintf("<t:%d:d> **%+d** %s", activity.CreatedAt.Unix(), activity.Reward, activity.Activity)
+		if activity.Moderator != "" {
+			line += fmt.Sprintf(" by <@%s>", activity.Moderator)
+		}
+		if activity.Reason != "" {
+			line += ": " + activity.Reason
+		}
+		lines = append(lines, line)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Point History",
+		Description: fmt.Sprintf("<@%s>\n\n%s", userID, strings.Join(lines, "\n")),
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Page %d of %d", page, pages),
+		},
+		Color:     0x00aaff,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	sendEmbed(s, m, embed)
+}
+
+// parseMention returns the user ID of a user mention
+func parseMention(arg string) (string, bool) {
+	match := mentionPattern.FindStringSubmatch(arg)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
@@ -0,0 +1,170 @@
+package discord
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// pruneThreshold is the number of tracked cooldowns above which the expired ones are dropped
+const pruneThreshold = 1000
+
+// Cooldown represents how long a command cannot be used again after being used
+type Cooldown struct {
+	User    time.Duration // per user, in any channel
+	Channel time.Duration // per channel, by any user
+	Global  time.Duration // by anyone, anywhere
+}
+
+// latencyBuckets are the upper bounds of the buckets the durations of command handlers are counted in
+var latencyBuckets = [...]time.Duration{
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// CommandStats represents the counters of a command, for monitoring
+type CommandStats struct {
+	Invoked     uint64 // times the handler was called
+	Denied      uint64 // times the user was not allowed to run the command
+	RateLimited uint64 // times the command was rejected because of a cooldown
+
+	Duration time.Duration               // total time spent in the handler
+	Latency  [len(latencyBuckets)]uint64 // handler calls by the first bucket their duration fits in
+}
+
+// rateLimiter tracks the cooldowns of the commands and counts how often they are used
+type rateLimiter struct {
+	mu       sync.Mutex
+	until    map[string]time.Time // cooldown key to the end of its cooldown
+	notified map[string]time.Time // user and command to the end of the cooldown they were told about
+	stats    map[string]*CommandStats
+}
+
+// newRateLimiter creates a new rateLimiter instance
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		until:    make(map[string]time.Time),
+		notified: make(map[string]time.Time),
+		stats:    make(map[string]*CommandStats),
+	}
+}
+
+// allow starts the cooldowns of the command when none of them is running and returns 0.
+// Otherwise it returns how long until the command can be used again, and whether the user
+// should be told so, which happens once per cooldown.
+func (rl *rateLimiter) allow(cmd *Command, userID, channelID string, now time.Time) (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	limits := map[string]time.Duration{
+		"user:" + cmd.Name + ":" + userID:       cmd.Cooldown.User,
+		"channel:" + cmd.Name + ":" + channelID: cmd.Cooldown.Channel,
+		"global:" + cmd.Name:                    cmd.Cooldown.Global,
+	}
+
+	var wait time.Duration
+	for key, cooldown := range limits {
+		if cooldown <= 0 {
+			continue
+		}
+		if remaining := rl.until[key].Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	stats := rl.statsFor(cmd.Name)
+	if wait > 0 {
+		stats.RateLimited++
+		notifyKey := cmd.Name + ":" + userID
+		if now.Before(rl.notified[notifyKey]) {
+			return wait, false
+		}
+		rl.notified[notifyKey] = now.Add(wait)
+		return wait, true
+	}
+
+	for key, cooldown := range limits {
+		if cooldown > 0 {
+			rl.until[key] = now.Add(cooldown)
+		}
+	}
+	stats.Invoked++
+	rl.prune(now)
+	return 0, false
+}
+
+// deny counts a command the user was not allowed to run
+func (rl *rateLimiter) deny(cmd *Command) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.statsFor(cmd.Name).Denied++
+}
+
+// observe counts how long the handler of a command took
+func (rl *rateLimiter) observe(cmd *Command, took time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	stats := rl.statsFor(cmd.Name)
+	stats.Duration += took
+	for i, bound := range latencyBuckets {
+		if took <= bound {
+			stats.Latency[i]++
+			break
+		}
+	}
+}
+
+// snapshot returns a copy of the counters of every command by name
+func (rl *rateLimiter) snapshot() map[string]CommandStats {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	stats := make(map[string]CommandStats, len(rl.stats))
+	for name, s := range rl.stats {
+		stats[name] = *s
+	}
+	return stats
+}
+
+// statsFor returns the counters of the command, creating them when needed.
+// The caller must hold the lock.
+func (rl *rateLimiter) statsFor(name string) *CommandStats {
+	stats, ok := rl.stats[name]
+	if !ok {
+		stats = &CommandStats{}
+		rl.stats[name] = stats
+	}
+	return stats
+}
+
+// prune drops the cooldowns that ended once there are many of them.
+// The caller must hold the lock.
+func (rl *rateLimiter) prune(now time.Time) {
+	for _, m := range []map[string]time.Time{rl.until, rl.notified} {
+		if len(m) < pruneThreshold {
+			continue
+		}
+		for key, until := range m {
+			if !now.Before(until) {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// sendCooldown tells the author of the message how long until they can use the command again
+func sendCooldown(s *discordgo.Session, m *discordgo.MessageCreate, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	reply(s, m, fmt.Sprintf("<@%s> Slow down! Please try again in %ds.", m.Author.ID, seconds))
+}
@@ -1,42 +1,302 @@
 package discord
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"sync"
+	"time"
 
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
 	"github.com/augustine0890/dapp-bot/pkg/logging"
 	"github.com/bwmarrin/discordgo"
 )
 
-// HandleRemoveReaction removes specific reactions from a message in response to a reaction add event.
-func HandleRemoveReaction(s *discordgo.Session, reaction *discordgo.MessageReactionAdd) {
-	channelID := reaction.ChannelID
-	messageID := reaction.MessageID
+// permissionCacheTTL is how long the permission of the bot to remove reactions in a channel is cached
+const permissionCacheTTL = 5 * time.Minute
 
-	// Define an array of reactions to be removed
-	removeReactions := []string{
-		"🖕🏻", "🖕", "🖕🏽",
+// customEmojiPattern matches a custom emoji as written in a message and captures its name and ID
+var customEmojiPattern = regexp.MustCompile(`^<a?:(\w+):(\d+)>$`)
+
+// cachedPermission represents whether the bot could remove reactions in a channel
+type cachedPermission struct {
+	allowed bool
+	expires time.Time
+}
+
+// Blocklist removes blocked reactions and escalates against users who keep adding them.
+// Emojis are blocked in every channel from the config, and per channel or everywhere
+// from the database.
+type Blocklist struct {
+	store  database.Store
+	cfg    *config.Config
+	ledger *Ledger
+	audit  *Auditor
+
+	mu      sync.RWMutex
+	blocked []database.BlockedReaction
+
+	permMu sync.Mutex
+	perms  map[string]cachedPermission // by channel ID
+
+	strikeMu sync.Mutex
+	strikes  map[string][]time.Time // times the reactions of a user were removed, by user ID
+}
+
+// NewBlocklist creates a new Blocklist instance, which blocks only the configured emojis until loaded
+func NewBlocklist(store database.Store, cfg *config.Config, ledger *Ledger, audit *Auditor) *Blocklist {
+	return &Blocklist{
+		store:   store,
+		cfg:     cfg,
+		ledger:  ledger,
+		audit:   audit,
+		perms:   make(map[string]cachedPermission),
+		strikes: make(map[string][]time.Time),
+	}
+}
+
+// Load reads the blocked reactions from the database
+func (b *Blocklist) Load(ctx context.Context) error {
+	blocked, err := b.store.ListBlockedReactions(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blocked = blocked
+	return nil
+}
+
+// Blocked reports whether the emoji is blocked in the channel
+func (b *Blocklist) Blocked(channelID string, emoji *discordgo.Emoji) bool {
+	for _, blocked := range b.cfg.Moderation.BlockedReactions {
+		if emojiMatches(blocked, emoji) {
+			return true
+		}
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, blocked := range b.blocked {
+		if (blocked.ChannelID == "" || blocked.ChannelID == channelID) && emojiMatches(blocked.Emoji, emoji) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add blocks the emoji in the channel, or in every channel when channelID is empty
+func (b *Blocklist) Add(ctx context.Context, emoji, channelID, addedBy string) error {
+	blocked := database.BlockedReaction{
+		Emoji:     emoji,
+		ChannelID: channelID,
+		AddedBy:   addedBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := b.store.AddBlockedReaction(ctx, &blocked); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blocked = append(b.blocked, blocked)
+	return nil
+}
+
+// Remove unblocks the emoji in the channel, or returns database.ErrNotFound
+func (b *Blocklist) Remove(ctx context.Context, emoji, channelID string) error {
+	if err := b.store.RemoveBlockedReaction(ctx, emoji, channelID); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, blocked := range b.blocked {
+		if blocked.Emoji == emoji && blocked.ChannelID == channelID {
+			b.blocked = append(b.blocked[:i], b.blocked[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// List returns the blocked reactions from the database
+func (b *Blocklist) List() []database.BlockedReaction {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return append([]database.BlockedReaction(nil), b.blocked...)
+}
+
+// canRemove reports whether the bot can remove reactions in the channel, checking Discord
+// at most once per permissionCacheTTL
+func (b *Blocklist) canRemove(s *discordgo.Session, channelID string) bool {
+	b.permMu.Lock()
+	defer b.permMu.Unlock()
+
+	now := time.Now()
+	if cached, ok := b.perms[channelID]; ok && now.Before(cached.expires) {
+		return cached.allowed
 	}
 
-	// Check if bot has permission to remove reactions
 	perms, err := s.UserChannelPermissions(s.State.User.ID, channelID)
 	if err != nil {
-		logging.Error("Failed to get bot permissions: %v", err)
-		return
+		logging.Error("Failed to get bot permissions", err)
+		return false
+	}
+	allowed := perms&discordgo.PermissionManageMessages != 0
+	if !allowed {
+		logging.Warn(fmt.Sprintf("Bot does not have permission to manage messages in channel %s", channelID))
+	}
+	b.perms[channelID] = cachedPermission{allowed: allowed, expires: now.Add(permissionCacheTTL)}
+	return allowed
+}
+
+// punish takes the penalty points from the user whose reaction was removed, and times them
+// out once they reach the number of strikes within the strike window
+func (b *Blocklist) punish(s *discordgo.Session, r *discordgo.MessageReaction) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mod := b.cfg.Moderation
+	if mod.Penalty > 0 {
+		b.penalize(ctx, s, r, mod.Penalty)
+	}
+	if mod.Strikes > 0 && b.strike(r.UserID, time.Now(), mod) {
+		until := time.Now().Add(mod.Timeout)
+		err := s.GuildMemberTimeout(r.GuildID, r.UserID, &until)
+		if err != nil {
+			logging.Error("Failed to time out member", err)
+			return
+		}
+		b.audit.Record(database.AuditEntry{
+			Event:     database.AuditMemberTimeout,
+			UserID:    r.UserID,
+			ChannelID: r.ChannelID,
+			Source:    r.Emoji.APIName(),
+			Details:   fmt.Sprintf("Timed out for %s after %d blocked reactions", mod.Timeout, mod.Strikes),
+		})
 	}
-	if perms&discordgo.PermissionManageMessages == 0 {
-		msg := fmt.Sprintf("Bot does not have permission to manage messages in channel %s", channelID)
-		logging.Warn(msg)
+}
+
+// penaltyAttempts is the number of times a penalty is tried when the points of the user
+// change between reading them and taking the penalty
+const penaltyAttempts = 3
+
+// penalize takes the penalty from the points of the user, without going below zero. The points
+// are only taken when the user still has them, so the penalty is lowered to the points they
+// have and tried again when their points dropped in between.
+func (b *Blocklist) penalize(ctx context.Context, s *discordgo.Session, r *discordgo.MessageReaction, penalty int) {
+	emoji := r.Emoji.APIName()
+	for attempt := 0; attempt < penaltyAttempts; attempt++ {
+		user, err := b.store.GetUser(ctx, r.UserID)
+		if err == database.ErrNotFound {
+			return
+		}
+		if err != nil {
+			logging.Error("Failed retrieving user points", err)
+			return
+		}
+		cost := penalty
+		if cost > user.Points {
+			cost = user.Points
+		}
+		if cost <= 0 {
+			return
+		}
+
+		now := time.Now().UTC()
+		_, err = b.ledger.Debit(ctx, s, &database.Activity{
+			User:      user.ID,
+			UserName:  user.UserName,
+			ChannelId: r.ChannelID,
+			Activity:  database.ActivityPenalty,
+			Reward:    -cost,
+			MessageId: r.MessageID,
+			Emoji:     emoji,
+			Key:       activityKey(database.ActivityPenalty, r.MessageID, emoji, r.UserID),
+			Moderator: s.State.User.ID,
+			Reason:    "Blocked reaction " + emoji,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err == database.ErrInsufficientPoints {
+			continue
+		}
+		if err != nil && err != database.ErrDuplicateActivity {
+			logging.Error("Failed to penalize user", err)
+		}
 		return
 	}
+	logging.Warn(fmt.Sprintf("Gave up penalizing user %s, their points kept changing", r.UserID))
+}
 
-	// Check if the reaction emoji is in the removeReactions array
-	for _, emoji := range removeReactions {
-		if emoji == reaction.Emoji.Name {
-			err := s.MessageReactionsRemoveEmoji(channelID, messageID, emoji)
-			if err != nil {
-				logging.Error("Failed to remove reaction:", err)
-			}
-			break
+// strike records a removed reaction of the user and reports whether they reached the number
+// of strikes within the window, in which case their strikes start over
+func (b *Blocklist) strike(userID string, now time.Time, mod config.ModerationConfig) bool {
+	b.strikeMu.Lock()
+	defer b.strikeMu.Unlock()
+
+	recent := b.strikes[userID][:0]
+	for _, at := range b.strikes[userID] {
+		if now.Sub(at) < mod.StrikeWindow {
+			recent = append(recent, at)
 		}
 	}
+	recent = append(recent, now)
+	if len(recent) >= mod.Strikes {
+		delete(b.strikes, userID)
+		return true
+	}
+	b.strikes[userID] = recent
+	return false
+}
+
+// HandleRemoveReaction removes blocked reactions from a message in response to a reaction add event.
+func (d *Discord) HandleRemoveReaction(s *discordgo.Session, reaction *discordgo.MessageReactionAdd) {
+	r := reaction.MessageReaction
+	if r.GuildID != d.cfg.GuildID || r.UserID == s.State.User.ID {
+		return
+	}
+	if !d.blocklist.Blocked(r.ChannelID, &r.Emoji) {
+		return
+	}
+	// Check if bot has permission to remove reactions
+	if !d.blocklist.canRemove(s, r.ChannelID) {
+		return
+	}
+
+	// Remove only the reaction of this user, leaving the others to be handled on their own
+	emoji := r.Emoji.APIName()
+	err := s.MessageReactionRemove(r.ChannelID, r.MessageID, emoji, r.UserID)
+	if err != nil {
+		logging.Error("Failed to remove reaction:", err)
+		return
+	}
+	d.metrics.reactionRemoved()
+	d.audit.Record(database.AuditEntry{
+		Event:     database.AuditReactionRemoved,
+		UserID:    r.UserID,
+		ChannelID: r.ChannelID,
+		Source:    emoji,
+		Details:   fmt.Sprintf("https://discord.com/channels/%s/%s/%s", r.GuildID, r.ChannelID, r.MessageID),
+	})
+	d.blocklist.punish(s, r)
+}
+
+// emojiMatches reports whether the blocked emoji, written as a unicode emoji, name:id or
+// the ID of a custom emoji, is the given emoji
+func emojiMatches(blocked string, emoji *discordgo.Emoji) bool {
+	return blocked == emoji.APIName() || (emoji.ID != "" && blocked == emoji.ID)
+}
+
+// normalizeEmoji turns an emoji argument into the form used by the blocklist,
+// writing custom emojis as name:id
+func normalizeEmoji(arg string) string {
+	if match := customEmojiPattern.FindStringSubmatch(arg); match != nil {
+		return match[1] + ":" + match[2]
+	}
+	return arg
 }
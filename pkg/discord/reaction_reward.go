@@ -0,0 +1,223 @@
+package discord
+
+import (
+	"context"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// reactionEvent represents a reaction that was added to or removed from a message
+type reactionEvent struct {
+	reaction *discordgo.MessageReaction
+	member   *discordgo.Member
+	removed  bool
+}
+
+// HandleReaction queues an added reaction to be rewarded
+func (d *Discord) HandleReaction(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	d.queueReaction(&reactionEvent{reaction: r.MessageReaction, member: r.Member})
+}
+
+// HandleReactionRemove queues a removed reaction so its reward is reversed
+func (d *Discord) HandleReactionRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	d.queueReaction(&reactionEvent{reaction: r.MessageReaction, removed: true})
+}
+
+// queueReaction queues the reaction, dropping it once the bot stopped so that a full queue
+// never blocks the handler
+func (d *Discord) queueReaction(event *reactionEvent) {
+	select {
+	case d.reactionCh <- event:
+	case <-d.stop:
+	}
+}
+
+// processReactions rewards and reverses reactions one at a time, so that adding and
+// removing the same reaction in quick succession is applied in order.
+func (d *Discord) processReactions() {
+	for {
+		select {
+		case event, ok := <-d.reactionCh:
+			if !ok {
+				return
+			}
+			d.processReaction(event)
+		case <-d.stop:
+			// The queue stays open when handlers were still in flight on shutdown,
+			// so handle the reactions already queued and return
+			for {
+				select {
+				case event, ok := <-d.reactionCh:
+					if !ok {
+						return
+					}
+					d.processReaction(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// processReaction rewards or reverses a queued reaction
+func (d *Discord) processReaction(event *reactionEvent) {
+	if event.removed {
+		reverseReaction(event.reaction, d.cfg, d.ledger)
+	} else if !d.blocklist.Blocked(event.reaction.ChannelID, &event.reaction.Emoji) {
+		rewardReaction(d.session, event, d.cfg, d.store, d.ledger)
+	}
+}
+
+// rewardReaction gives points to the user who reacted and to the author of the message
+func rewardReaction(s *discordgo.Session, event *reactionEvent, cfg *config.Config, store database.Store, ledger *Ledger) {
+	r := event.reaction
+	emoji := r.Emoji.APIName()
+	if r.GuildID != cfg.GuildID || !isRewardedReaction(cfg.Reactions, r.ChannelID, emoji) {
+		return
+	}
+
+	reactor := reactionUser(s, event)
+	if reactor == nil || reactor.Bot {
+		return
+	}
+
+	message, err := s.State.Message(r.ChannelID, r.MessageID)
+	if err != nil {
+		message, err = s.ChannelMessage(r.ChannelID, r.MessageID)
+		if err != nil {
+			logging.Error("Failed to get reacted message", err)
+			return
+		}
+	}
+	// Reacting to your own message does not earn points
+	author := message.Author
+	if author == nil || author.ID == reactor.ID {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	today := startOfDay(now, cfg.Location())
+
+	react := &database.Activity{
+		User:      reactor.ID,
+		UserName:  reactor.Username,
+		ChannelId: r.ChannelID,
+		Activity:  database.ActivityReact,
+		Reward:    cfg.Reactions.ReactReward,
+		MessageId: r.MessageID,
+		Emoji:     emoji,
+		Key:       activityKey(database.ActivityReact, r.MessageID, emoji, reactor.ID),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	awardReaction(ctx, s, react, cfg.Reactions.ReactDailyCap, today, store, ledger)
+
+	if author.Bot {
+		return
+	}
+	receive := &database.Activity{
+		User:      author.ID,
+		UserName:  author.Username,
+		ChannelId: r.ChannelID,
+		Activity:  database.ActivityReceive,
+		Reward:    cfg.Reactions.ReceiveReward,
+		MessageId: r.MessageID,
+		Emoji:     emoji,
+		FromUser:  reactor.ID,
+		Key:       activityKey(database.ActivityReceive, r.MessageID, emoji, reactor.ID),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	awardReaction(ctx, s, receive, cfg.Reactions.ReceiveDailyCap, today, store, ledger)
+}
+
+// awardReaction records the reaction activity and adds its reward to the user,
+// unless the same reaction was already rewarded or the user reached the daily cap.
+func awardReaction(ctx context.Context, s *discordgo.Session, activity *database.Activity, dailyCap int, today time.Time, store database.Store, ledger *Ledger) {
+	if activity.Reward == 0 {
+		return
+	}
+
+	count, err := store.CountActivities(ctx, database.ActivityFilter{
+		User:     activity.User,
+		Activity: activity.Activity,
+		Since:    today,
+	})
+	if err != nil {
+		logging.Error("Failed to count reaction activities", err)
+		return
+	}
+	if count >= dailyCap {
+		return
+	}
+
+	_, err = ledger.Apply(ctx, s, activity)
+	if err != nil && err != database.ErrDuplicateActivity {
+		logging.Error("Failed to reward reaction", err)
+	}
+}
+
+// reverseReaction takes back the points given for a reaction that was removed. Points the
+// user already spent are kept, and the ledger audits them.
+func reverseReaction(r *discordgo.MessageReaction, cfg *config.Config, ledger *Ledger) {
+	if r.GuildID != cfg.GuildID {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	emoji := r.Emoji.APIName()
+	keys := []string{
+		activityKey(database.ActivityReact, r.MessageID, emoji, r.UserID),
+		activityKey(database.ActivityReceive, r.MessageID, emoji, r.UserID),
+	}
+	for _, key := range keys {
+		_, _, err := ledger.Revert(ctx, database.ActivityFilter{Key: key})
+		if err != nil && err != database.ErrNotFound && err != database.ErrInsufficientPoints {
+			logging.Error("Failed to reverse reaction reward", err)
+		}
+	}
+}
+
+// reactionUser returns the user who added the reaction
+func reactionUser(s *discordgo.Session, event *reactionEvent) *discordgo.User {
+	if event.member != nil && event.member.User != nil {
+		return event.member.User
+	}
+	user, err := s.User(event.reaction.UserID)
+	if err != nil {
+		logging.Error("Failed to get reaction user", err)
+		return nil
+	}
+	return user
+}
+
+// isRewardedReaction reports whether the emoji earns points in the channel
+func isRewardedReaction(rc config.ReactionConfig, channelID, emoji string) bool {
+	if len(rc.Channels) > 0 && !contains(rc.Channels, channelID) {
+		return false
+	}
+	if len(rc.Emojis) > 0 && !contains(rc.Emojis, emoji) {
+		return false
+	}
+	return true
+}
+
+// contains reports whether the value is in the list
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxReportLines is the number of discrepancies listed in the reconciliation embed
+const maxReportLines = 15
+
+// ReconcileCommand returns a command handler function for the !reconcile command
+func ReconcileCommand(cfg *config.Config, store database.Store) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleReconcile(s, m, args, cfg, store)
+	}
+}
+
+// handleReconcile handles the !reconcile [repair] command, comparing the points of users with
+// their activities and rebuilding the points from the activities when asked to repair
+func handleReconcile(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, store database.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	repair := len(args) > 0 && args[0] == "repair"
+	report, err := database.Reconcile(ctx, store, repair)
+	if err != nil {
+		logging.Error("Failed to reconcile points", err)
+		reply(s, m, "Failed to reconcile the points, please check the logs.")
+		return
+	}
+
+	lines := make([]string, 0, maxReportLines)
+	for i, d := range report.Discrepancies {
+		if i == maxReportLines {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(report.Discrepancies)-maxReportLines))
+			break
+		}
+		lines = append(lines, d.String())
+	}
+	description := "The points of every user match their activities. ✅"
+	if len(lines) > 0 {
+		description = "```\n" + strings.Join(lines, "\n") + "\n```"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "Points Reconciliation",
+		Description: description,
+		Color:       0x00aaff,
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Users Checked",
+				Value:  fmt.Sprintf("%d", report.Checked),
+				Inline: true,
+			},
+			{
+				Name:   "Discrepancies",
+				Value:  fmt.Sprintf("%d", len(report.Discrepancies)),
+				Inline: true,
+			},
+			{
+				Name:   "Repaired",
+				Value:  fmt.Sprintf("%d", report.Repaired),
+				Inline: true,
+			},
+		},
+	}
+	sendEmbed(s, m, embed)
+}
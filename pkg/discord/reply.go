@@ -0,0 +1,82 @@
+package discord
+
+import (
+	"sync"
+
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// interactionReply tracks the response to a slash command that is handled as a message
+type interactionReply struct {
+	mu          sync.Mutex
+	interaction *discordgo.Interaction
+	replied     bool
+}
+
+// interactionReplies maps the ID of the message built for a slash command to its reply
+var interactionReplies sync.Map
+
+// sendMessage sends a text reply to the channel of the command message
+func sendMessage(s *discordgo.Session, m *discordgo.MessageCreate, content string) (*discordgo.Message, error) {
+	return sendComplex(s, m, &discordgo.MessageSend{Content: content})
+}
+
+// reply sends a text reply to the command message, logging when it cannot be sent
+func reply(s *discordgo.Session, m *discordgo.MessageCreate, message string) {
+	_, err := sendMessage(s, m, message)
+	if err != nil {
+		logging.Error("Error sending message", err)
+	}
+}
+
+// sendEmbed sends an embed reply to the channel of the command message
+func sendEmbed(s *discordgo.Session, m *discordgo.MessageCreate, embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
+	return sendComplex(s, m, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}})
+}
+
+// sendComplex sends a reply to the channel of the command message. When the command
+// was invoked as a slash command, the reply answers the interaction instead.
+func sendComplex(s *discordgo.Session, m *discordgo.MessageCreate, data *discordgo.MessageSend) (*discordgo.Message, error) {
+	value, ok := interactionReplies.Load(m.ID)
+	if !ok {
+		return s.ChannelMessageSendComplex(m.ChannelID, data)
+	}
+	pending := value.(*interactionReply)
+
+	embeds := data.Embeds
+	if data.Embed != nil {
+		embeds = append([]*discordgo.MessageEmbed{data.Embed}, embeds...)
+	}
+	files := data.Files
+	if data.File != nil {
+		files = append([]*discordgo.File{data.File}, files...)
+	}
+
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+
+	// The first reply replaces the deferred response, the next ones are follow-ups
+	if !pending.replied {
+		pending.replied = true
+		edit := &discordgo.WebhookEdit{
+			Content:         &data.Content,
+			Files:           files,
+			AllowedMentions: data.AllowedMentions,
+		}
+		if len(embeds) > 0 {
+			edit.Embeds = &embeds
+		}
+		if len(data.Components) > 0 {
+			edit.Components = &data.Components
+		}
+		return s.InteractionResponseEdit(pending.interaction, edit)
+	}
+	return s.FollowupMessageCreate(pending.interaction, true, &discordgo.WebhookParams{
+		Content:         data.Content,
+		Embeds:          embeds,
+		Components:      data.Components,
+		Files:           files,
+		AllowedMentions: data.AllowedMentions,
+	})
+}
@@ -0,0 +1,72 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// newHTTPServer creates the server of the health, readiness and metrics endpoints
+func (d *Discord) newHTTPServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", d.handleHealth)
+	mux.HandleFunc("/readyz", d.handleReady)
+	mux.HandleFunc("/metrics", d.handleMetrics)
+	return &http.Server{
+		Addr:              d.cfg.HTTPAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// serveHTTP starts listening on the configured address and serves the endpoints in the background
+func (d *Discord) serveHTTP() error {
+	listener, err := net.Listen("tcp", d.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", d.httpServer.Addr, err)
+	}
+	go func() {
+		err := d.httpServer.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			logging.Error("HTTP server stopped", err)
+		}
+	}()
+	logging.Info(fmt.Sprintf("Serving health and metrics on %s", listener.Addr()))
+	return nil
+}
+
+// handleHealth reports that the process is running
+func (d *Discord) handleHealth(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReady reports whether the bot is connected to the Discord gateway and MongoDB answers
+func (d *Discord) handleReady(w http.ResponseWriter, r *http.Request) {
+	d.session.RLock()
+	connected := d.session.DataReady
+	d.session.RUnlock()
+	if !connected {
+		http.Error(w, "discord gateway not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	err := d.mongoClient.Ping(ctx, readpref.Primary())
+	if err != nil {
+		http.Error(w, "mongodb not reachable: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleMetrics writes the metrics in the Prometheus text format
+func (d *Discord) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, d.CommandStats(), d.metrics)
+}
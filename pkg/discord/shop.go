@@ -0,0 +1,793 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// purchaseHistorySize is the number of purchases shown by !shop history
+const purchaseHistorySize = 10
+
+// Usages of the shop commands
+const (
+	shopUsage      = "Usage: `!shop` or `!shop history`"
+	buyUsage       = "Usage: `!buy <item>`, see `!shop` for the items"
+	shopAdminUsage = "Usage: `!shopadmin role <item> <price> <stock> @role <name>`, " +
+		"`!shopadmin temprole <item> <price> <stock> @role <duration> <name>`, " +
+		"`!shopadmin background <item> <price> <stock> <#color|image URL> <name>`, " +
+		"`!shopadmin raffle <item> <price> <stock> <name>`, " +
+		"`!shopadmin restock <item> <stock>`, `!shopadmin remove <item>` or `!shopadmin draw <item>`. " +
+		"A stock of 0 is unlimited."
+)
+
+var (
+	// itemIDPattern matches the short names items are bought with
+	itemIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+	// roleMentionPattern matches a role mention and captures the role ID
+	roleMentionPattern = regexp.MustCompile(`^<@&(\d+)>$`)
+	// hexColorPattern matches the hex colors of rank card backgrounds
+	hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// shopKinds describes the kinds of shop items, as shown in the shop
+var shopKinds = map[string]string{
+	database.ShopRole:       "Role",
+	database.ShopTempRole:   "Temporary role",
+	database.ShopBackground: "Rank card background",
+	database.ShopRaffle:     "Raffle ticket",
+}
+
+// Shop sells the items added by admins for points. The item is taken from its stock and the
+// price from the user before the item is given, and both are given back when it cannot be.
+type Shop struct {
+	store  database.Store
+	cfg    *config.Config
+	ledger *Ledger
+	audit  *Auditor
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	drawMu sync.Mutex // one raffle draw at a time, so that no ticket takes part in two
+
+	mu     sync.Mutex
+	buying map[string]bool // users whose purchase is in progress, by user ID
+}
+
+// NewShop creates a new Shop instance
+func NewShop(store database.Store, cfg *config.Config, ledger *Ledger, audit *Auditor) *Shop {
+	return &Shop{
+		store:  store,
+		cfg:    cfg,
+		ledger: ledger,
+		audit:  audit,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		buying: make(map[string]bool),
+	}
+}
+
+// intn returns a random number in [0, n)
+func (sh *Shop) intn(n int) int {
+	sh.rngMu.Lock()
+	defer sh.rngMu.Unlock()
+	return sh.rng.Intn(n)
+}
+
+// ShopCommand returns a command handler function for the !shop command
+func ShopCommand(cfg *config.Config, shop *Shop) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleShop(s, m, args, cfg, shop)
+	}
+}
+
+// BuyCommand returns a command handler function for the !buy command
+func BuyCommand(cfg *config.Config, shop *Shop) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleBuy(s, m, args, cfg, shop)
+	}
+}
+
+// ShopAdminCommand returns a command handler function for the !shopadmin command
+func ShopAdminCommand(cfg *config.Config, shop *Shop) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleShopAdmin(s, m, args, cfg, shop)
+	}
+}
+
+// shopOptions returns the slash command options of the !shop command
+func shopOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "items",
+			Description: "Show the items for sale",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "history",
+			Description: "Show the items you bought",
+		},
+	}
+}
+
+// buyOptions returns the slash command options of the !buy command
+func buyOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "item",
+			Description: "The item to buy, as shown in the shop",
+			Required:    true,
+		},
+	}
+}
+
+// shopAdminOptions returns the slash command options of the !shopadmin command
+func shopAdminOptions() []*discordgo.ApplicationCommandOption {
+	minPrice, minStock := 1.0, 0.0
+	item := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "item",
+		Description: "The short name the item is bought with",
+		Required:    true,
+	}
+	stock := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "stock",
+		Description: "The items for sale, 0 for unlimited",
+		Required:    true,
+		MinValue:    &minStock,
+	}
+	role := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionRole,
+		Name:        "role",
+		Description: "The role given",
+		Required:    true,
+	}
+	add := func(kind, description string, options ...*discordgo.ApplicationCommandOption) *discordgo.ApplicationCommandOption {
+		options = append([]*discordgo.ApplicationCommandOption{
+			item,
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "price", Description: "The price in points", Required: true, MinValue: &minPrice},
+			stock,
+		}, options...)
+		options = append(options, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "name",
+			Description: "The name shown in the shop",
+			Required:    true,
+		})
+		return &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        kind,
+			Description: description,
+			Options:     options,
+		}
+	}
+	edit := func(name, description string, options ...*discordgo.ApplicationCommandOption) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        name,
+			Description: description,
+			Options:     append([]*discordgo.ApplicationCommandOption{item}, options...),
+		}
+	}
+	return []*discordgo.ApplicationCommandOption{
+		add(database.ShopRole, "Sell a role kept for good", role),
+		add(database.ShopTempRole, "Sell a role kept for a while", role, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "duration",
+			Description: "How long the role is kept, e.g. 7d or 12h",
+			Required:    true,
+		}),
+		add(database.ShopBackground, "Sell a rank card background", &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "background",
+			Description: "A hex color like #1e90ff or an image URL",
+			Required:    true,
+		}),
+		add(database.ShopRaffle, "Sell raffle tickets"),
+		edit("restock", "Set the stock of an item", stock),
+		edit("remove", "Take an item off sale"),
+		edit("draw", "Draw the winner of a raffle"),
+	}
+}
+
+// handleShop handles the !shop command, showing the items for sale or the purchases of the user
+func handleShop(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, shop *Shop) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch {
+	case len(args) == 0 || (len(args) == 1 && args[0] == "items"):
+		showShop(ctx, s, m, shop)
+	case len(args) == 1 && args[0] == "history":
+		showPurchases(ctx, s, m, shop)
+	default:
+		reply(s, m, shopUsage)
+	}
+}
+
+// showShop sends the items for sale, cheapest first
+func showShop(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, shop *Shop) {
+	items, err := shop.store.ListShopItems(ctx)
+	if err != nil {
+		logging.Error("Failed to list shop items", err)
+		reply(s, m, "Failed to open the shop, please try again later.")
+		return
+	}
+
+	fields := make([]*discordgo.MessageEmbedField, 0, len(items))
+	for _, item := range items {
+		details := []string{fmt.Sprintf("**%d** points", item.Price), describeItem(&item)}
+		if !item.Unlimited() {
+			details = append(details, fmt.Sprintf("%d left", item.Stock))
+		}
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("%s (`%s`)", item.Name, item.ID),
+			Value: strings.Join(details, " · "),
+		})
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Points Shop 🛒",
+		Color:     0x00aaff,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Fields:    fields,
+		Footer:    &discordgo.MessageEmbedFooter{Text: "Buy an item with !buy <item>"},
+	}
+	if len(fields) == 0 {
+		embed.Description = "The shop is empty for now, come back later."
+		embed.Footer = nil
+	}
+	sendEmbed(s, m, embed)
+}
+
+// showPurchases sends the last items the user bought
+func showPurchases(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, shop *Shop) {
+	purchases, err := shop.store.ListPurchases(ctx, database.PurchaseFilter{User: m.Author.ID}, purchaseHistorySize)
+	if err != nil {
+		logging.Error("Failed to list purchases", err)
+		reply(s, m, "Failed to get your purchases, please try again later.")
+		return
+	}
+
+	lines := make([]string, 0, len(purchases))
+	for _, purchase := range purchases {
+		line := fmt.Sprintf("<t:%d:d> **%s** for %d points", purchase.CreatedAt.Unix(), purchase.Name, purchase.Price)
+		switch {
+		case purchase.Kind != database.ShopTempRole:
+		case purchase.Expired:
+			line += ", expired"
+		default:
+			line += fmt.Sprintf(", expires <t:%d:R>", purchase.ExpiresAt.Unix())
+		}
+		lines = append(lines, line)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Purchases of %s", m.Author.Username),
+		Description: strings.Join(lines, "\n"),
+		Color:       0x00aaff,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+	if len(lines) == 0 {
+		embed.Description = "You have not bought anything yet, see `!shop` for the items."
+	}
+	sendEmbed(s, m, embed)
+}
+
+// describeItem returns what buying the item gives
+func describeItem(item *database.ShopItem) string {
+	switch item.Kind {
+	case database.ShopRole:
+		return fmt.Sprintf("<@&%s> role", item.RoleID)
+	case database.ShopTempRole:
+		return fmt.Sprintf("<@&%s> role for %s", item.RoleID, formatDays(item.Duration))
+	default:
+		return shopKinds[item.Kind]
+	}
+}
+
+// handleBuy handles the !buy command, selling the item to the user
+func handleBuy(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, shop *Shop) {
+	if len(args) != 1 {
+		reply(s, m, buyUsage)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	item, err := shop.store.GetShopItem(ctx, strings.ToLower(args[0]))
+	switch {
+	case err == database.ErrNotFound:
+		reply(s, m, fmt.Sprintf("<@%s> There is no `%s` in the shop, see `!shop` for the items.", m.Author.ID, args[0]))
+		return
+	case err != nil:
+		logging.Error("Failed to get shop item", err)
+		reply(s, m, "Failed to buy the item, please try again later.")
+		return
+	}
+	// The checks and the charge are done one purchase at a time per user, so that two
+	// purchases of a role do not both pass the checks and both get charged
+	if !shop.startBuying(m.Author.ID) {
+		reply(s, m, fmt.Sprintf("<@%s> Wait for your last purchase to complete first.", m.Author.ID))
+		return
+	}
+	defer shop.doneBuying(m.Author.ID)
+	if !shop.canBuy(ctx, s, m, item) {
+		return
+	}
+
+	purchase, err := shop.buy(ctx, s, m, item.ID)
+	switch {
+	case err == database.ErrOutOfStock:
+		reply(s, m, fmt.Sprintf("<@%s> **%s** is sold out.", m.Author.ID, item.Name))
+		return
+	case err == database.ErrInsufficientPoints:
+		reply(s, m, fmt.Sprintf("<@%s> You need %d points to buy **%s**.", m.Author.ID, item.Price, item.Name))
+		return
+	case err != nil:
+		logging.Error(fmt.Sprintf("Failed to sell %s to %s", item.ID, m.Author.ID), err)
+		reply(s, m, "Failed to buy the item, please try again later. No points were taken.")
+		return
+	}
+
+	description := fmt.Sprintf("<@%s> bought **%s** for %d points.", m.Author.ID, purchase.Name, purchase.Price)
+	switch purchase.Kind {
+	case database.ShopRole:
+		description += fmt.Sprintf("\nYou now have the <@&%s> role.", purchase.RoleID)
+	case database.ShopTempRole:
+		description += fmt.Sprintf("\nYou have the <@&%s> role until <t:%d:f>.", purchase.RoleID, purchase.ExpiresAt.Unix())
+	case database.ShopBackground:
+		description += "\nYour rank card now uses it, see `!card`."
+	case database.ShopRaffle:
+		description += "\nYour ticket is in for the next draw, good luck!"
+	}
+	sendEmbed(s, m, &discordgo.MessageEmbed{
+		Title:       "Purchase Complete",
+		Description: description,
+		Color:       0x00aaff,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	})
+}
+
+// startBuying marks the user as buying, reporting false when they already are
+func (sh *Shop) startBuying(userID string) bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.buying[userID] {
+		return false
+	}
+	sh.buying[userID] = true
+	return true
+}
+
+// doneBuying marks the purchase of the user as complete
+func (sh *Shop) doneBuying(userID string) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	delete(sh.buying, userID)
+}
+
+// canBuy reports whether the user can buy the item, telling them why not otherwise. Buying a
+// background they already own uses it again for free.
+func (sh *Shop) canBuy(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, item *database.ShopItem) bool {
+	switch item.Kind {
+	case database.ShopTempRole:
+		active, err := sh.store.ListPurchases(ctx, database.PurchaseFilter{User: m.Author.ID, Item: item.ID, Active: true}, 1)
+		if err != nil {
+			logging.Error("Failed to list purchases", err)
+			reply(s, m, "Failed to buy the item, please try again later.")
+			return false
+		}
+		if len(active) > 0 {
+			reply(s, m, fmt.Sprintf("<@%s> You already have **%s**, it expires <t:%d:R>.", m.Author.ID, item.Name, active[0].ExpiresAt.Unix()))
+			return false
+		}
+		fallthrough
+	case database.ShopRole:
+		// The member of the message may predate a purchase that completed since, so their
+		// roles are fetched again
+		member, err := s.GuildMember(m.GuildID, m.Author.ID)
+		if err != nil {
+			logging.Error("Failed to get guild member", err)
+			reply(s, m, "Failed to buy the item, please try again later.")
+			return false
+		}
+		if contains(member.Roles, item.RoleID) {
+			reply(s, m, fmt.Sprintf("<@%s> You already have the role of **%s**.", m.Author.ID, item.Name))
+			return false
+		}
+	case database.ShopBackground:
+		owned, err := sh.store.ListPurchases(ctx, database.PurchaseFilter{User: m.Author.ID, Item: item.ID}, 1)
+		if err != nil {
+			logging.Error("Failed to list purchases", err)
+			reply(s, m, "Failed to buy the item, please try again later.")
+			return false
+		}
+		if len(owned) > 0 {
+			if err := sh.store.SetBackground(ctx, m.Author.ID, item.Background); err != nil {
+				logging.Error("Failed to set rank card background", err)
+				reply(s, m, "Failed to use the background, please try again later.")
+				return false
+			}
+			reply(s, m, fmt.Sprintf("<@%s> You already own **%s**, your rank card uses it again.", m.Author.ID, item.Name))
+			return false
+		}
+	}
+	return true
+}
+
+// buy takes the item from its stock and its price from the user, records the purchase and
+// gives the item. When any step fails, the steps before it are undone.
+func (sh *Shop) buy(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, itemID string) (*database.Purchase, error) {
+	item, err := sh.store.TakeShopStock(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	key := activityKey(database.ActivityPurchase, m.ID)
+	_, err = sh.ledger.Debit(ctx, s, &database.Activity{
+		User:      m.Author.ID,
+		UserName:  m.Author.Username,
+		ChannelId: m.ChannelID,
+		Activity:  database.ActivityPurchase,
+		Reward:    -item.Price,
+		MessageId: m.ID,
+		Key:       key,
+		Reason:    fmt.Sprintf("Bought %s (%s)", item.Name, item.ID),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		sh.returnStock(item.ID)
+		return nil, err
+	}
+
+	purchase := &database.Purchase{
+		ID:        m.ID,
+		User:      m.Author.ID,
+		UserName:  m.Author.Username,
+		Item:      item.ID,
+		Name:      item.Name,
+		Kind:      item.Kind,
+		Price:     item.Price,
+		RoleID:    item.RoleID,
+		CreatedAt: now,
+	}
+	if item.Kind == database.ShopTempRole {
+		purchase.ExpiresAt = now.Add(item.Duration)
+	}
+	// The purchase is recorded before the role is given, so that a temporary role is always expired
+	if err := sh.store.InsertPurchase(ctx, purchase); err != nil {
+		sh.refund(key, item.ID, "")
+		return nil, err
+	}
+
+	switch item.Kind {
+	case database.ShopRole, database.ShopTempRole:
+		err = s.GuildMemberRoleAdd(sh.cfg.GuildID, m.Author.ID, item.RoleID)
+	case database.ShopBackground:
+		err = sh.store.SetBackground(ctx, m.Author.ID, item.Background)
+	}
+	if err != nil {
+		sh.refund(key, item.ID, purchase.ID)
+		return nil, fmt.Errorf("failed to give %s item: %w", item.Kind, err)
+	}
+	return purchase, nil
+}
+
+// refund gives back the points and the stock of a purchase that could not be completed,
+// and deletes the purchase when it was recorded
+func (sh *Shop) refund(key, itemID, purchaseID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, _, err := sh.ledger.Revert(ctx, database.ActivityFilter{Key: key}); err != nil {
+		logging.Error(fmt.Sprintf("Failed to refund purchase %s", key), err)
+	}
+	sh.returnStock(itemID)
+	if purchaseID != "" {
+		if err := sh.store.DeletePurchase(ctx, purchaseID); err != nil {
+			logging.Error(fmt.Sprintf("Failed to delete purchase %s", purchaseID), err)
+		}
+	}
+}
+
+// returnStock puts an item back into its stock after a purchase failed
+func (sh *Shop) returnStock(itemID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sh.store.ReturnShopStock(ctx, itemID); err != nil {
+		logging.Error(fmt.Sprintf("Failed to return stock of %s", itemID), err)
+	}
+}
+
+// handleShopAdmin handles the !shopadmin command, letting admins manage the items for sale
+func handleShopAdmin(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, shop *Shop) {
+	if len(args) < 2 || !itemIDPattern.MatchString(args[1]) {
+		reply(s, m, shopAdminUsage)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	itemID := args[1]
+	switch args[0] {
+	case database.ShopRole, database.ShopTempRole, database.ShopBackground, database.ShopRaffle:
+		item, reason := parseShopItem(args[0], itemID, args[2:])
+		if item == nil {
+			reply(s, m, reason)
+			return
+		}
+		now := time.Now().UTC()
+		item.CreatedBy = m.Author.ID
+		item.CreatedAt = now
+		item.UpdatedAt = now
+
+		err := shop.store.AddShopItem(ctx, item)
+		switch {
+		case err == database.ErrAlreadyExists:
+			reply(s, m, fmt.Sprintf("There is already a `%s` item, remove it first.", itemID))
+		case err != nil:
+			logging.Error("Failed to add shop item", err)
+			reply(s, m, "Failed to add the item, please check the logs.")
+		default:
+			reply(s, m, fmt.Sprintf("**%s** (`%s`) is now for sale for %d points.", item.Name, item.ID, item.Price))
+		}
+	case "restock":
+		if len(args) != 3 {
+			reply(s, m, shopAdminUsage)
+			return
+		}
+		stock, ok := parseStock(args[2])
+		if !ok {
+			reply(s, m, "The stock must be a number, 0 for unlimited.")
+			return
+		}
+		err := shop.store.SetShopStock(ctx, itemID, stock)
+		switch {
+		case err == database.ErrNotFound:
+			reply(s, m, fmt.Sprintf("There is no `%s` item.", itemID))
+		case err != nil:
+			logging.Error("Failed to set shop stock", err)
+			reply(s, m, "Failed to restock the item, please check the logs.")
+		case stock < 0:
+			reply(s, m, fmt.Sprintf("`%s` is now unlimited.", itemID))
+		default:
+			reply(s, m, fmt.Sprintf("`%s` now has %d left.", itemID, stock))
+		}
+	case "remove":
+		err := shop.store.RemoveShopItem(ctx, itemID)
+		switch {
+		case err == database.ErrNotFound:
+			reply(s, m, fmt.Sprintf("There is no `%s` item.", itemID))
+		case err != nil:
+			logging.Error("Failed to remove shop item", err)
+			reply(s, m, "Failed to remove the item, please check the logs.")
+		default:
+			reply(s, m, fmt.Sprintf("`%s` is no longer for sale. Temporary roles bought before still expire.", itemID))
+		}
+	case "draw":
+		drawRaffle(ctx, s, m, itemID, shop)
+	default:
+		reply(s, m, shopAdminUsage)
+	}
+}
+
+// parseShopItem parses the arguments of a new item of the kind. It returns the reason to show
+// the admin when they are not valid.
+func parseShopItem(kind, itemID string, args []string) (*database.ShopItem, string) {
+	// Price, stock, the kind's own arguments and at least one word of name
+	need := map[string]int{
+		database.ShopRole:       4,
+		database.ShopTempRole:   5,
+		database.ShopBackground: 4,
+		database.ShopRaffle:     3,
+	}[kind]
+	if len(args) < need {
+		return nil, shopAdminUsage
+	}
+
+	price, err := strconv.Atoi(args[0])
+	if err != nil || price < 1 {
+		return nil, "The price must be a number from 1."
+	}
+	stock, ok := parseStock(args[1])
+	if !ok {
+		return nil, "The stock must be a number, 0 for unlimited."
+	}
+	item := &database.ShopItem{
+		ID:    itemID,
+		Name:  strings.Join(args[need-1:], " "),
+		Kind:  kind,
+		Price: price,
+		Stock: stock,
+	}
+
+	switch kind {
+	case database.ShopRole, database.ShopTempRole:
+		match := roleMentionPattern.FindStringSubmatch(args[2])
+		if match == nil {
+			return nil, "The role must be a role mention."
+		}
+		item.RoleID = match[1]
+	case database.ShopBackground:
+		background := args[2]
+		if !hexColorPattern.MatchString(background) && !strings.HasPrefix(background, "https://") {
+			return nil, "The background must be a hex color like #1e90ff or an https image URL."
+		}
+		item.Background = background
+	}
+	if kind == database.ShopTempRole {
+		duration, ok := parseDays(args[3])
+		if !ok {
+			return nil, "The duration must be like 7d, 12h or 30m."
+		}
+		item.Duration = duration
+	}
+	return item, ""
+}
+
+// parseStock parses the stock of an item, where 0 is unlimited
+func parseStock(arg string) (int, bool) {
+	stock, err := strconv.Atoi(arg)
+	if err != nil || stock < 0 {
+		return 0, false
+	}
+	if stock == 0 {
+		return -1, true
+	}
+	return stock, true
+}
+
+// parseDays parses a positive duration, which can also be given in days like 7d
+func parseDays(arg string) (time.Duration, bool) {
+	if strings.HasSuffix(arg, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(arg, "d"))
+		return time.Duration(n) * 24 * time.Hour, err == nil && n > 0
+	}
+	duration, err := time.ParseDuration(arg)
+	return duration, err == nil && duration > 0
+}
+
+// formatDays writes the duration in days when it is a whole number of days
+func formatDays(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		days := int(d / (24 * time.Hour))
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	}
+	return d.String()
+}
+
+// drawRaffle draws a winner among the tickets bought for the raffle item since its last draw,
+// every ticket having the same chance. The tickets are then marked drawn, so that the next draw
+// only has the tickets bought after this one.
+func drawRaffle(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, itemID string, shop *Shop) {
+	item, err := shop.store.GetShopItem(ctx, itemID)
+	switch {
+	case err == database.ErrNotFound:
+		reply(s, m, fmt.Sprintf("There is no `%s` item.", itemID))
+		return
+	case err != nil:
+		logging.Error("Failed to get shop item", err)
+		reply(s, m, "Failed to draw the raffle, please check the logs.")
+		return
+	case item.Kind != database.ShopRaffle:
+		reply(s, m, fmt.Sprintf("`%s` is not a raffle.", itemID))
+		return
+	}
+
+	shop.drawMu.Lock()
+	defer shop.drawMu.Unlock()
+
+	tickets, err := shop.store.ListPurchases(ctx, database.PurchaseFilter{Item: itemID, Undrawn: true}, 0)
+	if err != nil {
+		logging.Error("Failed to list raffle tickets", err)
+		reply(s, m, "Failed to draw the raffle, please check the logs.")
+		return
+	}
+	if len(tickets) == 0 {
+		reply(s, m, fmt.Sprintf("No tickets were bought for **%s** since the last draw.", item.Name))
+		return
+	}
+
+	ids := make([]string, len(tickets))
+	for i, ticket := range tickets {
+		ids[i] = ticket.ID
+	}
+	if err := shop.store.MarkDrawn(ctx, ids); err != nil {
+		logging.Error("Failed to mark raffle tickets drawn", err)
+		reply(s, m, "Failed to draw the raffle, please check the logs.")
+		return
+	}
+
+	winner := tickets[shop.intn(len(tickets))]
+	_, err = sendComplex(s, m, &discordgo.MessageSend{
+		Content: fmt.Sprintf("<@%s>", winner.User),
+		Embeds: []*discordgo.MessageEmbed{{
+			Title:       "Raffle Draw 🎟️",
+			Description: fmt.Sprintf("<@%s> won **%s**, drawn from %d tickets!", winner.User, item.Name, len(tickets)),
+			Color:       0x00aaff,
+			Timestamp:   time.Now().Format(time.RFC3339),
+		}},
+	})
+	if err != nil {
+		logging.Error("Error sending message", err)
+	}
+}
+
+// expireRoles removes the temporary roles whose time is over. A role which cannot be removed
+// is tried again on the next run, unless the member or the role no longer exists.
+func (sh *Shop) expireRoles(s *discordgo.Session) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	expired, err := sh.store.ListPurchases(ctx, database.PurchaseFilter{ExpiresBefore: time.Now().UTC()}, 0)
+	if err != nil {
+		logging.Error("Failed to list expired temporary roles", err)
+		return
+	}
+	for _, purchase := range expired {
+		err := s.GuildMemberRoleRemove(sh.cfg.GuildID, purchase.User, purchase.RoleID)
+		var restErr *discordgo.RESTError
+		if err != nil && errors.As(err, &restErr) && restErr.Message != nil &&
+			(restErr.Message.Code == discordgo.ErrCodeUnknownMember || restErr.Message.Code == discordgo.ErrCodeUnknownRole) {
+			err = nil
+		}
+		if err != nil {
+			logging.Error(fmt.Sprintf("Failed to remove temporary role %s from %s", purchase.RoleID, purchase.User), err)
+			continue
+		}
+
+		if err := sh.store.ExpirePurchase(ctx, purchase.ID); err != nil {
+			logging.Error(fmt.Sprintf("Failed to expire purchase %s", purchase.ID), err)
+			continue
+		}
+		sh.audit.Record(database.AuditEntry{
+			Event:    database.AuditRoleExpired,
+			UserID:   purchase.User,
+			UserName: purchase.UserName,
+			Source:   purchase.Item,
+			Details:  fmt.Sprintf("Removed the <@&%s> role of %s, bought <t:%d:f>", purchase.RoleID, purchase.Name, purchase.CreatedAt.Unix()),
+		})
+	}
+}
+
+// expireShopRoles removes the expired temporary roles every expiry interval, until the bot shuts down
+func (d *Discord) expireShopRoles() {
+	interval := d.cfg.Shop.ExpiryInterval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		d.shop.expireRoles(d.session)
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/bwmarrin/discordgo"
+)
+
+// memberBatchSize is the number of members fetched from Discord at a time
+const memberBatchSize = 1000
+
+// memberSync prevents the startup sync and the !sync command from running at the same time
+var memberSync sync.Mutex
+
+// errSyncRunning is returned when a member sync is already in progress
+var errSyncRunning = errors.New("member sync already running")
+
+// SyncReport represents the result of syncing the users with the members of the guild
+type SyncReport struct {
+	Members  int // non-bot members in the guild
+	Created  int // members who had no user yet
+	Restored int // users who left and are members again
+	Updated  int // users whose name or joined date changed
+	Left     int // users who are no longer members
+}
+
+// String summarizes the report in one line
+func (r *SyncReport) String() string {
+	return fmt.Sprintf("%d members: %d created, %d restored, %d updated, %d marked as left",
+		r.Members, r.Created, r.Restored, r.Updated, r.Left)
+}
+
+// HandleReady syncs the users with the members of the guild once the bot is connected
+func HandleReady(s *discordgo.Session, event *discordgo.Ready, store database.Store, cfg *config.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := syncMembers(ctx, s, store, cfg)
+	if err != nil {
+		logging.Error("Failed to sync guild members", err)
+		return
+	}
+	logging.Info("Synced guild members: " + report.String())
+}
+
+// SyncCommand returns a command handler function for the !sync command
+func SyncCommand(cfg *config.Config, store database.Store) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleSync(s, m, args, cfg, store)
+	}
+}
+
+// handleSync handles the !sync command, syncing the users with the members of the guild
+func handleSync(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, store database.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := syncMembers(ctx, s, store, cfg)
+	if err == errSyncRunning {
+		reply(s, m, "The members are already being synced, please try again later.")
+		return
+	}
+	if err != nil {
+		logging.Error("Failed to sync guild members", err)
+		reply(s, m, "Failed to sync the members, please check the logs.")
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "Member Sync",
+		Color:     0x00aaff,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Members", Value: fmt.Sprintf("%d", report.Members), Inline: true},
+			{Name: "Created", Value: fmt.Sprintf("%d", report.Created), Inline: true},
+			{Name: "Restored", Value: fmt.Sprintf("%d", report.Restored), Inline: true},
+			{Name: "Updated", Value: fmt.Sprintf("%d", report.Updated), Inline: true},
+			{Name: "Left", Value: fmt.Sprintf("%d", report.Left), Inline: true},
+		},
+	}
+	sendEmbed(s, m, embed)
+}
+
+// syncMembers creates a user for every member of the guild, restores or resets the users who
+// rejoined according to the rejoin policy, and marks the users who are no longer members as left
+func syncMembers(ctx context.Context, s *discordgo.Session, store database.Store, cfg *config.Config) (*SyncReport, error) {
+	if !memberSync.TryLock() {
+		return nil, errSyncRunning
+	}
+	defer memberSync.Unlock()
+
+	members, err := fetchMembers(s, cfg.GuildID)
+	if err != nil {
+		return nil, err
+	}
+	// Never mark everyone as left because the member list came back empty
+	if len(members) == 0 {
+		return nil, fmt.Errorf("no members found in guild %s", cfg.GuildID)
+	}
+
+	users, err := store.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*database.User, len(users))
+	for i := range users {
+		existing[users[i].ID] = &users[i]
+	}
+
+	report := &SyncReport{}
+	inGuild := make(map[string]bool, len(members))
+	for _, member := range members {
+		if member.User.Bot {
+			continue
+		}
+		report.Members++
+		inGuild[member.User.ID] = true
+
+		user, ok := existing[member.User.ID]
+		switch {
+		case !ok || !user.Active():
+			_, err := joinUser(ctx, store, cfg, member.User.ID, member.User.Username, member.JoinedAt)
+			if err != nil {
+				return report, fmt.Errorf("failed to add member %s: %w", member.User.ID, err)
+			}
+			if ok {
+				report.Restored++
+			} else {
+				report.Created++
+			}
+		// MongoDB stores times with millisecond precision
+		case user.UserName != member.User.Username || !user.JoinedDate.Equal(member.JoinedAt.Truncate(time.Millisecond)):
+			err := store.UpdateMember(ctx, member.User.ID, member.User.Username, member.JoinedAt)
+			if err != nil {
+				return report, fmt.Errorf("failed to update member %s: %w", member.User.ID, err)
+			}
+			report.Updated++
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, user := range users {
+		if user.Active() && !inGuild[user.ID] {
+			err := store.MarkLeft(ctx, user.ID, now)
+			if err != nil && err != database.ErrNotFound {
+				return report, fmt.Errorf("failed to mark user %s as left: %w", user.ID, err)
+			}
+			report.Left++
+		}
+	}
+	return report, nil
+}
+
+// fetchMembers returns every member of the guild, fetched in batches
+func fetchMembers(s *discordgo.Session, guildID string) ([]*discordgo.Member, error) {
+	var members []*discordgo.Member
+	var lastMemberID string
+	for {
+		fetchedMembers, err := s.GuildMembers(guildID, lastMemberID, memberBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch members: %w", err)
+		}
+		members = append(members, fetchedMembers...)
+
+		if len(fetchedMembers) < memberBatchSize {
+			return members, nil
+		}
+		lastMemberID = fetchedMembers[len(fetchedMembers)-1].User.ID
+	}
+}
@@ -0,0 +1,538 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/augustine0890/dapp-bot/pkg/trivia"
+	"github.com/bwmarrin/discordgo"
+)
+
+// triviaComponent is the custom ID prefix of the answer buttons of trivia questions
+const triviaComponent = "trivia"
+
+// triviaUsage explains the arguments of the !trivia command
+const triviaUsage = "Usage: `!trivia start [category] [rounds]`, `!trivia stop`, `!trivia reload` or `!trivia categories`"
+
+// triviaPause is how long the results of a round are shown before the next question
+const triviaPause = 5 * time.Second
+
+// triviaStandings is the number of players shown in the standings after each round
+const triviaStandings = 5
+
+// Trivia hosts the trivia games, at most one per channel, with the questions of the bank.
+// Questions with choices are answered with buttons, the others by typing the answer.
+type Trivia struct {
+	cfg    *config.Config
+	ledger *Ledger
+
+	bankMu sync.RWMutex
+	bank   *trivia.Bank // nil until a bank was loaded
+
+	mu      sync.Mutex
+	runs    map[string]*triviaRun // by channel ID
+	closed  bool                  // set by Close, after which no game starts
+	workers *sync.WaitGroup       // games in progress, waited for on shutdown
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+}
+
+// triviaRun represents a trivia game in progress in a channel
+type triviaRun struct {
+	id        string // command that started the game, which keys its activities
+	channelID string
+	game      *trivia.Game
+	stop      chan struct{}
+	stopOnce  sync.Once
+
+	mu       sync.Mutex
+	question *trivia.Question // question of the current round
+}
+
+// NewTrivia creates a new Trivia instance, which has no questions until Load is called.
+// The games it runs are added to workers.
+func NewTrivia(cfg *config.Config, ledger *Ledger, workers *sync.WaitGroup) *Trivia {
+	return &Trivia{
+		cfg:     cfg,
+		ledger:  ledger,
+		runs:    make(map[string]*triviaRun),
+		workers: workers,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Load reads the question bank from the configured file, replacing the current one.
+// The games in progress keep the questions they started with.
+func (t *Trivia) Load() (*trivia.Bank, error) {
+	bank, err := trivia.LoadBank(t.cfg.Trivia.BankPath)
+	if err != nil {
+		return nil, err
+	}
+
+	t.bankMu.Lock()
+	defer t.bankMu.Unlock()
+	t.bank = bank
+	return bank, nil
+}
+
+// questionBank returns the loaded question bank, or nil
+func (t *Trivia) questionBank() *trivia.Bank {
+	t.bankMu.RLock()
+	defer t.bankMu.RUnlock()
+	return t.bank
+}
+
+// TriviaCommand returns a command handler function for the !trivia command
+func TriviaCommand(cfg *config.Config, host *Trivia) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleTrivia(s, m, args, cfg, host)
+	}
+}
+
+// triviaOptions returns the slash command options of the !trivia command
+func triviaOptions() []*discordgo.ApplicationCommandOption {
+	minRounds := 1.0
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "start",
+			Description: "Start a trivia game in this channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				{Type: discordgo.ApplicationCommandOptionString, Name: "category", Description: "The category of the questions, every category when empty"},
+				{Type: discordgo.ApplicationCommandOptionInteger, Name: "rounds", Description: "The number of questions", MinValue: &minRounds},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "stop",
+			Description: "Stop the trivia game of this channel without giving points",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "reload",
+			Description: "Reload the question bank",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "categories",
+			Description: "Show the categories of the questions",
+		},
+	}
+}
+
+// handleTrivia handles the !trivia command, letting admins run trivia games
+func handleTrivia(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, host *Trivia) {
+	if len(args) == 0 {
+		reply(s, m, triviaUsage)
+		return
+	}
+
+	switch args[0] {
+	case "start":
+		category, rounds, ok := parseTriviaArgs(args[1:], cfg.Trivia)
+		if !ok {
+			reply(s, m, triviaUsage)
+			return
+		}
+		host.start(s, m, category, rounds)
+	case "stop":
+		if !host.stop(m.ChannelID) {
+			reply(s, m, "No trivia game is running in this channel.")
+		}
+	case "reload":
+		bank, err := host.Load()
+		if err != nil {
+			logging.Error("Failed to load question bank", err)
+			reply(s, m, fmt.Sprintf("Failed to load the question bank, the previous one is kept: %v", err))
+			return
+		}
+		reply(s, m, fmt.Sprintf("Loaded %d questions in %d categories.", bank.Len(), len(bank.Categories())))
+	case "categories":
+		bank := host.questionBank()
+		if bank == nil {
+			reply(s, m, "No question bank is loaded, use `!trivia reload` once it is fixed.")
+			return
+		}
+		lines := make([]string, 0, len(bank.Categories()))
+		for _, category := range bank.Categories() {
+			lines = append(lines, fmt.Sprintf("**%s**: %d questions", category, bank.Count(category)))
+		}
+		sendEmbed(s, m, &discordgo.MessageEmbed{
+			Title:       "Trivia Categories",
+			Description: strings.Join(lines, "\n"),
+			Color:       0x00aaff,
+			Timestamp:   time.Now().Format(time.RFC3339),
+		})
+	default:
+		reply(s, m, triviaUsage)
+	}
+}
+
+// parseTriviaArgs reads the optional category and number of rounds of !trivia start,
+// bounding the rounds to the configured maximum
+func parseTriviaArgs(args []string, cfg config.TriviaConfig) (string, int, bool) {
+	category := ""
+	rounds := cfg.Rounds
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n < 1 {
+				return "", 0, false
+			}
+			rounds = n
+			continue
+		}
+		if category != "" {
+			return "", 0, false
+		}
+		category = arg
+	}
+	if cfg.MaxRounds > 0 && rounds > cfg.MaxRounds {
+		rounds = cfg.MaxRounds
+	}
+	return category, rounds, true
+}
+
+// start starts a trivia game in the channel of the message, unless one is already running
+func (t *Trivia) start(s *discordgo.Session, m *discordgo.MessageCreate, category string, rounds int) {
+	bank := t.questionBank()
+	if bank == nil {
+		reply(s, m, "No question bank is loaded, use `!trivia reload` once it is fixed.")
+		return
+	}
+
+	t.rngMu.Lock()
+	questions, err := bank.Pick(category, rounds, t.rng)
+	t.rngMu.Unlock()
+	if err != nil {
+		reply(s, m, fmt.Sprintf("There are no questions in the %q category, see `!trivia categories`.", category))
+		return
+	}
+
+	run := &triviaRun{
+		id:        m.ID,
+		channelID: m.ChannelID,
+		game:      trivia.NewGame(questions, t.cfg.Trivia.Points),
+		stop:      make(chan struct{}),
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		reply(s, m, "The bot is shutting down, please try again later.")
+		return
+	}
+	if _, running := t.runs[m.ChannelID]; running {
+		t.mu.Unlock()
+		reply(s, m, "A trivia game is already running in this channel.")
+		return
+	}
+	t.runs[m.ChannelID] = run
+	t.workers.Add(1)
+	t.mu.Unlock()
+
+	topic := "every category"
+	if category != "" {
+		topic = "the " + category + " category"
+	}
+	reply(s, m, fmt.Sprintf("🧠 Trivia is starting: %d questions from %s, %s each. The fastest correct answers score the most!",
+		run.game.Rounds(), topic, t.cfg.Trivia.RoundTime))
+	go func() {
+		defer t.workers.Done()
+		t.play(s, run)
+	}()
+}
+
+// stop stops the game running in the channel, and reports whether there was one
+func (t *Trivia) stop(channelID string) bool {
+	t.mu.Lock()
+	run, ok := t.runs[channelID]
+	t.mu.Unlock()
+	if ok {
+		run.stopOnce.Do(func() { close(run.stop) })
+	}
+	return ok
+}
+
+// Close stops the games in progress without giving points, when the bot shuts down.
+// No game starts afterwards, so waiting for the workers waits for the last ones to finish.
+func (t *Trivia) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for _, run := range t.runs {
+		run.stopOnce.Do(func() { close(run.stop) })
+	}
+}
+
+// play asks the questions of the game one round at a time, then gives the rewards
+func (t *Trivia) play(s *discordgo.Session, run *triviaRun) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.runs, run.channelID)
+		t.mu.Unlock()
+	}()
+
+	for {
+		round, question, ok := run.game.Next()
+		if !ok {
+			break
+		}
+		run.mu.Lock()
+		run.question = question
+		run.mu.Unlock()
+
+		message, err := s.ChannelMessageSendComplex(run.channelID, triviaQuestionMessage(run, round, question))
+		if err != nil {
+			logging.Error("Failed to send trivia question", err)
+		}
+		stopped := wait(run.stop, t.cfg.Trivia.RoundTime)
+		result := run.game.EndRound()
+		if message != nil && len(question.Choices) > 0 {
+			// Remove the answer buttons of the closed question
+			_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+				ID:         message.ID,
+				Channel:    run.channelID,
+				Components: []discordgo.MessageComponent{},
+			})
+			if err != nil {
+				logging.Error("Failed to close trivia question", err)
+			}
+		}
+		if stopped {
+			sendTriviaMessage(s, run.channelID, "🛑 Trivia was stopped, no points were given.")
+			return
+		}
+
+		_, err = s.ChannelMessageSendEmbed(run.channelID, triviaRoundEmbed(round, run.game.Rounds(), result, run.game.Leaderboard()))
+		if err != nil {
+			logging.Error("Failed to send trivia round results", err)
+		}
+		if round < run.game.Rounds() && wait(run.stop, triviaPause) {
+			sendTriviaMessage(s, run.channelID, "🛑 Trivia was stopped, no points were given.")
+			return
+		}
+	}
+
+	t.reward(s, run)
+}
+
+// reward gives the configured rewards to the best players of the game, and posts the final leaderboard
+func (t *Trivia) reward(s *discordgo.Session, run *triviaRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	var lines []string
+	for i, score := range run.game.Leaderboard() {
+		if score.Points <= 0 {
+			break
+		}
+		line := fmt.Sprintf("**#%d** <@%s> %d points (%d correct)", i+1, score.UserID, score.Points, score.Correct)
+		if i < len(t.cfg.Trivia.Rewards) && t.cfg.Trivia.Rewards[i] > 0 {
+			reward := t.cfg.Trivia.Rewards[i]
+			_, err := t.ledger.Apply(ctx, s, &database.Activity{
+				User:      score.UserID,
+				UserName:  score.UserName,
+				ChannelId: run.channelID,
+				Activity:  database.ActivityTrivia,
+				Reward:    reward,
+				MessageId: run.id,
+				Key:       activityKey(database.ActivityTrivia, run.id, score.UserID),
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+			if err != nil && err != database.ErrDuplicateActivity {
+				logging.Error("Failed to reward trivia player", err)
+			} else {
+				line += fmt.Sprintf(" → **+%d** points", reward)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "🏆 Trivia Results",
+		Description: "Nobody answered correctly, better luck next time!",
+		Color:       0x00aaff,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+	if len(lines) > 0 {
+		embed.Description = strings.Join(lines, "\n")
+	}
+	_, err := s.ChannelMessageSendComplex(run.channelID, &discordgo.MessageSend{
+		Embeds:          []*discordgo.MessageEmbed{embed},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		logging.Error("Failed to send trivia results", err)
+	}
+}
+
+// TriviaAnswerHandler returns a component handler function for the answer buttons of trivia questions
+func TriviaAnswerHandler(host *Trivia) ComponentHandlerFunc {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+		host.handleAnswer(s, i, args)
+	}
+}
+
+// handleAnswer records the answer of the clicked button, and tells the player privately
+func (t *Trivia) handleAnswer(s *discordgo.Session, i *discordgo.InteractionCreate, args []string) {
+	if len(args) != 3 {
+		return
+	}
+	round, err1 := strconv.Atoi(args[1])
+	choice, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil {
+		return
+	}
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+
+	message := "This question is closed."
+	t.mu.Lock()
+	run, ok := t.runs[i.ChannelID]
+	t.mu.Unlock()
+	if ok && run.id == args[0] {
+		run.mu.Lock()
+		question := run.question
+		run.mu.Unlock()
+		if question != nil && choice >= 0 && choice < len(question.Choices) {
+			if run.game.Answer(round, user.ID, user.Username, question.Choices[choice]) {
+				message = fmt.Sprintf("Your answer **%s** is locked in.", question.Choices[choice])
+			} else if current, open := run.game.Round(); current == round && open {
+				message = "You already answered this question."
+			}
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: message,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logging.Error("Failed to respond to trivia answer", err)
+	}
+}
+
+// HandleMessage records the typed answers to the trivia questions without choices
+func (t *Trivia) HandleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.Author == nil || m.Author.Bot || strings.HasPrefix(m.Content, "!") {
+		return
+	}
+	t.mu.Lock()
+	run, ok := t.runs[m.ChannelID]
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	run.mu.Lock()
+	question := run.question
+	run.mu.Unlock()
+	round, open := run.game.Round()
+	if question == nil || !open || len(question.Choices) > 0 {
+		return
+	}
+	if run.game.Answer(round, m.Author.ID, m.Author.Username, m.Content) {
+		// Acknowledge the answer without telling whether it is right
+		err := s.MessageReactionAdd(m.ChannelID, m.ID, "✍️")
+		if err != nil {
+			logging.Error("Failed to acknowledge trivia answer", err)
+		}
+	}
+}
+
+// triviaQuestionMessage builds the message asking the question of the round
+func triviaQuestionMessage(run *triviaRun, round int, question *trivia.Question) *discordgo.MessageSend {
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Question %d/%d", round, run.game.Rounds()),
+		Description: question.Text,
+		Color:       0x00aaff,
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Type your answer in this channel"},
+	}
+	if question.Category != "" {
+		embed.Title += " · " + question.Category
+	}
+
+	send := &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}}
+	if len(question.Choices) > 0 {
+		embed.Footer.Text = "Click your answer, you only get one try"
+		buttons := make([]discordgo.MessageComponent, len(question.Choices))
+		for i, choice := range question.Choices {
+			buttons[i] = discordgo.Button{
+				Label:    choice,
+				Style:    discordgo.SecondaryButton,
+				CustomID: componentID(triviaComponent, run.id, strconv.Itoa(round), strconv.Itoa(i)),
+			}
+		}
+		send.Components = []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+	}
+	return send
+}
+
+// triviaRoundEmbed builds the embed showing the answer, the fastest correct players and the standings
+func triviaRoundEmbed(round, rounds int, result trivia.RoundResult, standings []trivia.Score) *discordgo.MessageEmbed {
+	winners := "Nobody got it right."
+	if len(result.Winners) > 0 {
+		lines := make([]string, len(result.Winners))
+		for i, winner := range result.Winners {
+			lines[i] = fmt.Sprintf("%d. <@%s> +%d", i+1, winner.UserID, winner.Points)
+		}
+		winners = strings.Join(lines, "\n")
+	}
+
+	var lines []string
+	for i, score := range standings {
+		if i == triviaStandings {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("**#%d** <@%s> %d points", i+1, score.UserID, score.Points))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "Nobody answered yet.")
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Round %d/%d", round, rounds),
+		Description: fmt.Sprintf("The answer was **%s**.", result.Question.Answer),
+		Color:       0x00aaff,
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Fastest", Value: winners, Inline: true},
+			{Name: "Standings", Value: strings.Join(lines, "\n"), Inline: true},
+		},
+	}
+}
+
+// wait waits for the duration and reports whether stop was closed first
+func wait(stop <-chan struct{}, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-stop:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// sendTriviaMessage sends a text message to the channel of a trivia game
+func sendTriviaMessage(s *discordgo.Session, channelID, message string) {
+	_, err := s.ChannelMessageSend(channelID, message)
+	if err != nil {
+		logging.Error("Error sending message", err)
+	}
+}
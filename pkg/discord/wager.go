@@ -0,0 +1,343 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/logging"
+	"github.com/augustine0890/dapp-bot/pkg/wager"
+	"github.com/bwmarrin/discordgo"
+)
+
+// Usages of the wagering commands
+const (
+	flipUsage  = "Usage: `!flip <points> heads|tails`"
+	slotsUsage = "Usage: `!slots <points>`"
+)
+
+// Wagers resolves the bets of !flip and !slots. The stake is taken from the user before the bet
+// is resolved, so a user can never bet points they don't have, and winnings are paid back after.
+type Wagers struct {
+	store  database.Store
+	cfg    *config.Config
+	ledger *Ledger
+	audit  *Auditor
+	rng    wager.RNG
+
+	mu      sync.Mutex
+	betting map[string]bool // users whose stake is being taken, by user ID
+}
+
+// NewWagers creates a new Wagers instance resolving the bets with the RNG
+func NewWagers(store database.Store, cfg *config.Config, ledger *Ledger, audit *Auditor, rng wager.RNG) *Wagers {
+	return &Wagers{
+		store:   store,
+		cfg:     cfg,
+		ledger:  ledger,
+		audit:   audit,
+		rng:     rng,
+		betting: make(map[string]bool),
+	}
+}
+
+// FlipCommand returns a command handler function for the !flip command
+func FlipCommand(cfg *config.Config, wagers *Wagers) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleFlip(s, m, args, cfg, wagers)
+	}
+}
+
+// SlotsCommand returns a command handler function for the !slots command
+func SlotsCommand(cfg *config.Config, wagers *Wagers) CommandHandlerFunc {
+	return func(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+		handleSlots(s, m, args, cfg, wagers)
+	}
+}
+
+// flipOptions returns the slash command options of the !flip command
+func flipOptions(cfg *config.Config) []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		stakeOption(cfg),
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "side",
+			Description: "The side you bet on",
+			Required:    true,
+			Choices: []*discordgo.ApplicationCommandOptionChoice{
+				{Name: wager.Heads, Value: wager.Heads},
+				{Name: wager.Tails, Value: wager.Tails},
+			},
+		},
+	}
+}
+
+// slotsOptions returns the slash command options of the !slots command
+func slotsOptions(cfg *config.Config) []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{stakeOption(cfg)}
+}
+
+// stakeOption returns the slash command option of the points a user bets
+func stakeOption(cfg *config.Config) *discordgo.ApplicationCommandOption {
+	minBet := float64(cfg.Wagers.MinBet)
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "points",
+		Description: "The points you bet",
+		Required:    true,
+		MinValue:    &minBet,
+		MaxValue:    float64(cfg.Wagers.MaxBet),
+	}
+}
+
+// handleFlip handles the !flip command, doubling the stake when the user calls the side right
+func handleFlip(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, wagers *Wagers) {
+	if len(args) != 2 {
+		reply(s, m, flipUsage)
+		return
+	}
+	stake, err := strconv.Atoi(args[0])
+	call := strings.ToLower(args[1])
+	if err != nil || (call != wager.Heads && call != wager.Tails) {
+		reply(s, m, flipUsage)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := wagers.escrow(ctx, s, m, stake, "flip")
+	if err != nil {
+		replyEscrow(s, m, cfg, stake, err)
+		return
+	}
+	result := wager.Flip(wagers.rng, stake, call)
+	points := user.Points
+	if result.Payout > 0 {
+		var ok bool
+		points, ok = wagers.payout(s, m, result.Payout, "flip")
+		if !ok {
+			return
+		}
+	}
+
+	message := fmt.Sprintf("<@%s> 🪙 The coin landed on **%s**. ", m.Author.ID, result.Side)
+	if result.Payout > 0 {
+		message += fmt.Sprintf("You won **%d** points!", result.Payout-stake)
+	} else {
+		message += fmt.Sprintf("You lost **%d** points.", stake)
+	}
+	reply(s, m, message+fmt.Sprintf(" You now have %d points.", points))
+}
+
+// handleSlots handles the !slots command, paying the stake times the multiplier of the reels
+func handleSlots(s *discordgo.Session, m *discordgo.MessageCreate, args []string, cfg *config.Config, wagers *Wagers) {
+	if len(args) != 1 {
+		reply(s, m, slotsUsage)
+		return
+	}
+	stake, err := strconv.Atoi(args[0])
+	if err != nil {
+		reply(s, m, slotsUsage)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := wagers.escrow(ctx, s, m, stake, "slots")
+	if err != nil {
+		replyEscrow(s, m, cfg, stake, err)
+		return
+	}
+	result := wager.Spin(wagers.rng, stake)
+	points := user.Points
+	if result.Payout > 0 {
+		var ok bool
+		points, ok = wagers.payout(s, m, result.Payout, "slots")
+		if !ok {
+			return
+		}
+	}
+
+	message := fmt.Sprintf("<@%s> 🎰 | %s | ", m.Author.ID, strings.Join(result.Reels[:], " "))
+	switch {
+	case result.Payout > stake:
+		message += fmt.Sprintf("Jackpot! You won **%d** points!", result.Payout-stake)
+	case result.Payout == stake:
+		message += "Two of a kind, you get your stake back."
+	default:
+		message += fmt.Sprintf("You lost **%d** points.", stake)
+	}
+	reply(s, m, message+fmt.Sprintf(" You now have %d points.", points))
+}
+
+// Errors of bets that cannot be placed
+var (
+	errBetOutOfRange = errors.New("bet is out of range")
+	errBetInProgress = errors.New("bet is in progress")
+)
+
+// lossLimitError is returned when a bet could make the user lose more than the daily loss limit
+type lossLimitError struct {
+	left int // points the user can still lose today
+}
+
+func (e *lossLimitError) Error() string {
+	return fmt.Sprintf("daily loss limit reached, %d points left", e.left)
+}
+
+// escrow checks the bet against the limits and takes the stake from the user, returning them
+// with their points after the stake. A user places one bet at a time, so that two bets can't
+// both pass the daily loss limit before either stake is taken.
+func (w *Wagers) escrow(ctx context.Context, s *discordgo.Session, m *discordgo.MessageCreate, stake int, game string) (*database.User, error) {
+	limits := w.cfg.Wagers
+	if stake < limits.MinBet || (limits.MaxBet > 0 && stake > limits.MaxBet) {
+		return nil, errBetOutOfRange
+	}
+
+	w.mu.Lock()
+	if w.betting[m.Author.ID] {
+		w.mu.Unlock()
+		return nil, errBetInProgress
+	}
+	w.betting[m.Author.ID] = true
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.betting, m.Author.ID)
+		w.mu.Unlock()
+	}()
+
+	if limits.DailyLossLimit > 0 {
+		lost, err := w.lostToday(ctx, m.Author.ID)
+		if err != nil {
+			return nil, err
+		}
+		if lost+stake > limits.DailyLossLimit {
+			return nil, &lossLimitError{left: limits.DailyLossLimit - lost}
+		}
+	}
+
+	now := time.Now().UTC()
+	return w.ledger.Debit(ctx, s, &database.Activity{
+		User:      m.Author.ID,
+		UserName:  m.Author.Username,
+		ChannelId: m.ChannelID,
+		Activity:  database.ActivityWager,
+		Reward:    -stake,
+		MessageId: m.ID,
+		Key:       activityKey(database.ActivityWager, m.ID),
+		Game:      game,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+// replyEscrow tells the user why their bet could not be placed
+func replyEscrow(s *discordgo.Session, m *discordgo.MessageCreate, cfg *config.Config, stake int, err error) {
+	var limit *lossLimitError
+	switch {
+	case err == errBetOutOfRange && cfg.Wagers.MaxBet > 0:
+		reply(s, m, fmt.Sprintf("<@%s> Bets must be between %d and %d points.", m.Author.ID, cfg.Wagers.MinBet, cfg.Wagers.MaxBet))
+	case err == errBetOutOfRange:
+		reply(s, m, fmt.Sprintf("<@%s> Bets must be at least %d points.", m.Author.ID, cfg.Wagers.MinBet))
+	case err == errBetInProgress:
+		reply(s, m, fmt.Sprintf("<@%s> Wait for your last bet to be resolved first.", m.Author.ID))
+	case errors.As(err, &limit):
+		tomorrow := startOfDay(time.Now(), cfg.Location()).AddDate(0, 0, 1)
+		reply(s, m, fmt.Sprintf("<@%s> You can lose at most %d more points today, the limit resets <t:%d:R>.",
+			m.Author.ID, limit.left, tomorrow.Unix()))
+	case err == database.ErrInsufficientPoints:
+		reply(s, m, fmt.Sprintf("<@%s> You don't have %d points to bet.", m.Author.ID, stake))
+	default:
+		logging.Error("Failed to place bet", err)
+		reply(s, m, "Failed to place your bet, please try again later.")
+	}
+}
+
+// payoutAttempts is the number of times the winnings of a bet are tried to be paid out
+const payoutAttempts = 3
+
+// payout gives the winnings of a bet to the user and returns their points after the bet.
+// The payout is keyed by the bet, so it is retried without paying twice. When it still fails,
+// the owed points are recorded in the audit log for an admin to give them.
+func (w *Wagers) payout(s *discordgo.Session, m *discordgo.MessageCreate, payout int, game string) (int, bool) {
+	now := time.Now().UTC()
+	activity := &database.Activity{
+		User:      m.Author.ID,
+		UserName:  m.Author.Username,
+		ChannelId: m.ChannelID,
+		Activity:  database.ActivityPayout,
+		Reward:    payout,
+		MessageId: m.ID,
+		Key:       activityKey(database.ActivityPayout, m.ID),
+		Game:      game,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	var err error
+	for attempt := 0; attempt < payoutAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		var points int
+		points, err = w.applyPayout(s, activity)
+		if err == nil {
+			return points, true
+		}
+		logging.Warn(fmt.Sprintf("Failed to pay out %d points of bet %s", payout, m.ID), err)
+	}
+
+	logging.Error(fmt.Sprintf("Gave up paying out %d points of bet %s", payout, m.ID), err)
+	w.audit.Record(database.AuditEntry{
+		Event:     database.AuditPayoutOwed,
+		UserID:    m.Author.ID,
+		UserName:  m.Author.Username,
+		ChannelID: m.ChannelID,
+		Source:    game,
+		Details:   fmt.Sprintf("Owed %d points for bet %s, give them with `!points give`", payout, m.ID),
+	})
+	reply(s, m, "Failed to pay out your bet, an admin will give you your winnings.")
+	return 0, false
+}
+
+// applyPayout applies the payout activity and returns the points of the user after it,
+// which were already given when the activity was applied by an earlier attempt
+func (w *Wagers) applyPayout(s *discordgo.Session, activity *database.Activity) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := w.ledger.Apply(ctx, s, activity)
+	if err == database.ErrDuplicateActivity {
+		user, err = w.store.GetUser(ctx, activity.User)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return user.Points, nil
+}
+
+// lostToday returns the points the user lost betting since the start of the day, 0 when they won
+func (w *Wagers) lostToday(ctx context.Context, userID string) (int, error) {
+	today := startOfDay(time.Now(), w.cfg.Location())
+	staked, err := w.store.SumActivities(ctx, database.ActivityFilter{User: userID, Activity: database.ActivityWager, Since: today})
+	if err != nil {
+		return 0, err
+	}
+	paid, err := w.store.SumActivities(ctx, database.ActivityFilter{User: userID, Activity: database.ActivityPayout, Since: today})
+	if err != nil {
+		return 0, err
+	}
+	if net := staked + paid; net < 0 {
+		return -net, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,163 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/augustine0890/dapp-bot/internal/database"
+	"github.com/augustine0890/dapp-bot/pkg/config"
+	"github.com/augustine0890/dapp-bot/pkg/leveling"
+	"github.com/augustine0890/dapp-bot/pkg/wager"
+	"github.com/bwmarrin/discordgo"
+)
+
+// newTestWagers returns wagers on a memory store, where the user u1 has the points
+func newTestWagers(t *testing.T, points int) (*Wagers, *database.MemoryStore) {
+	t.Helper()
+	cfg := &config.Config{Wagers: config.WagerConfig{MinBet: 10, MaxBet: 100, DailyLossLimit: 150}}
+	store := database.NewMemoryStore()
+	now := time.Now().UTC()
+	_, err := store.ApplyActivity(context.Background(), &database.Activity{
+		User:      "u1",
+		UserName:  "alice",
+		Activity:  database.ActivityAdjust,
+		Reward:    points,
+		Key:       "seed:u1",
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	curve, err := leveling.NewCurve(config.LevelingConfig{Curve: "linear", Base: 100})
+	if err != nil {
+		t.Fatalf("NewCurve: %v", err)
+	}
+	ledger := NewLedger(store, cfg, curve, nil, nil)
+	return NewWagers(store, cfg, ledger, nil, wager.NewRNG(1)), store
+}
+
+// betMessage returns the message of a bet of u1
+func betMessage(id string) *discordgo.MessageCreate {
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        id,
+		ChannelID: "c1",
+		Author:    &discordgo.User{ID: "u1", Username: "alice"},
+	}}
+}
+
+// userPoints returns the points of u1
+func userPoints(t *testing.T, store database.Store) int {
+	t.Helper()
+	user, err := store.GetUser(context.Background(), "u1")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	return user.Points
+}
+
+func TestEscrowLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		points int
+		stake  int
+		err    error
+		after  int
+	}{
+		{name: "below the minimum", points: 500, stake: 5, err: errBetOutOfRange, after: 500},
+		{name: "above the maximum", points: 500, stake: 101, err: errBetOutOfRange, after: 500},
+		{name: "insufficient points", points: 50, stake: 60, err: database.ErrInsufficientPoints, after: 50},
+		{name: "minimum bet", points: 500, stake: 10, after: 490},
+		{name: "maximum bet", points: 500, stake: 100, after: 400},
+		{name: "every point", points: 60, stake: 60, after: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, store := newTestWagers(t, tt.points)
+			user, err := w.escrow(context.Background(), nil, betMessage("m1"), tt.stake, "flip")
+			if err != tt.err {
+				t.Fatalf("escrow() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && user.Points != tt.after {
+				t.Errorf("escrow() user points = %d, want %d", user.Points, tt.after)
+			}
+			if points := userPoints(t, store); points != tt.after {
+				t.Errorf("points = %d, want %d", points, tt.after)
+			}
+		})
+	}
+}
+
+func TestEscrowDailyLossLimit(t *testing.T) {
+	w, store := newTestWagers(t, 1000)
+	ctx := context.Background()
+
+	if _, err := w.escrow(ctx, nil, betMessage("m1"), 100, "flip"); err != nil {
+		t.Fatalf("first bet: %v", err)
+	}
+	_, err := w.escrow(ctx, nil, betMessage("m2"), 60, "flip")
+	var limit *lossLimitError
+	if !errors.As(err, &limit) || limit.left != 50 {
+		t.Fatalf("second bet error = %v, want 50 points left", err)
+	}
+	if points := userPoints(t, store); points != 900 {
+		t.Errorf("points = %d, want 900", points)
+	}
+
+	// Winnings paid back count against the losses of the day
+	if _, ok := w.payout(nil, betMessage("m1"), 20, "flip"); !ok {
+		t.Fatal("payout failed")
+	}
+	if _, err := w.escrow(ctx, nil, betMessage("m2"), 60, "flip"); err != nil {
+		t.Fatalf("bet after payout: %v", err)
+	}
+}
+
+func TestEscrowBetInProgress(t *testing.T) {
+	w, store := newTestWagers(t, 500)
+	w.betting["u1"] = true
+
+	_, err := w.escrow(context.Background(), nil, betMessage("m1"), 50, "flip")
+	if err != errBetInProgress {
+		t.Fatalf("escrow() error = %v, want %v", err, errBetInProgress)
+	}
+	if points := userPoints(t, store); points != 500 {
+		t.Errorf("points = %d, want 500", points)
+	}
+}
+
+func TestEscrowConcurrentBets(t *testing.T) {
+	w, store := newTestWagers(t, 1000)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w.escrow(context.Background(), nil, betMessage(fmt.Sprintf("m%d", i)), 100, "slots")
+		}(i)
+	}
+	wg.Wait()
+
+	if points := userPoints(t, store); points < 1000-w.cfg.Wagers.DailyLossLimit {
+		t.Errorf("points = %d, lost more than the daily limit of %d", points, w.cfg.Wagers.DailyLossLimit)
+	}
+}
+
+func TestPayoutIdempotent(t *testing.T) {
+	w, store := newTestWagers(t, 100)
+
+	for i := 0; i < 2; i++ {
+		points, ok := w.payout(nil, betMessage("m1"), 40, "flip")
+		if !ok || points != 140 {
+			t.Fatalf("payout %d = %d, %v, want 140, true", i, points, ok)
+		}
+	}
+	if points := userPoints(t, store); points != 140 {
+		t.Errorf("points = %d, want 140", points)
+	}
+}
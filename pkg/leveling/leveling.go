@@ -0,0 +1,102 @@
+package leveling
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/augustine0890/dapp-bot/pkg/config"
+)
+
+// Curve maps the points of a user to a level
+type Curve interface {
+	// Threshold returns the total points needed to reach the level.
+	// It returns -1 when the level cannot be reached.
+	Threshold(level int) int
+}
+
+// Progress represents the level of a user and the XP gained within that level
+type Progress struct {
+	Level      int
+	CurrentXP  int // points gained since reaching the level
+	RequiredXP int // points needed to go from the level to the next one, 0 at the max level
+}
+
+// NewCurve creates the level curve described by the configuration
+func NewCurve(cfg config.LevelingConfig) (Curve, error) {
+	switch cfg.Curve {
+	case "linear":
+		if cfg.Base <= 0 {
+			return nil, fmt.Errorf("linear level curve needs a positive base, got %d", cfg.Base)
+		}
+		return linearCurve{base: cfg.Base}, nil
+	case "", "quadratic":
+		if cfg.Base <= 0 {
+			return nil, fmt.Errorf("quadratic level curve needs a positive base, got %d", cfg.Base)
+		}
+		return quadraticCurve{base: cfg.Base}, nil
+	case "table":
+		if len(cfg.Table) == 0 {
+			return nil, fmt.Errorf("table level curve needs at least one level")
+		}
+		if !sort.IntsAreSorted(cfg.Table) {
+			return nil, fmt.Errorf("table level curve must be in ascending order")
+		}
+		return tableCurve{thresholds: cfg.Table}, nil
+	default:
+		return nil, fmt.Errorf("unsupported level curve %q", cfg.Curve)
+	}
+}
+
+// GetProgress returns the level reached with the given points and the XP within that level
+func GetProgress(curve Curve, points int) Progress {
+	level := 0
+	for {
+		next := curve.Threshold(level + 1)
+		if next < 0 || next > points {
+			break
+		}
+		level++
+	}
+
+	progress := Progress{
+		Level:     level,
+		CurrentXP: points - curve.Threshold(level),
+	}
+	if next := curve.Threshold(level + 1); next >= 0 {
+		progress.RequiredXP = next - curve.Threshold(level)
+	}
+	return progress
+}
+
+// linearCurve needs the same number of points for every level
+type linearCurve struct {
+	base int
+}
+
+func (c linearCurve) Threshold(level int) int {
+	return c.base * level
+}
+
+// quadraticCurve needs more points for every next level
+type quadraticCurve struct {
+	base int
+}
+
+func (c quadraticCurve) Threshold(level int) int {
+	return c.base * level * level
+}
+
+// tableCurve reads the points needed for each level from a table, where the first entry is level 1
+type tableCurve struct {
+	thresholds []int
+}
+
+func (c tableCurve) Threshold(level int) int {
+	if level <= 0 {
+		return 0
+	}
+	if level > len(c.thresholds) {
+		return -1
+	}
+	return c.thresholds[level-1]
+}
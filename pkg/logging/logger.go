@@ -43,3 +43,8 @@ func Warn(message string, err ...error) {
 		log.Warn().Msg(message)
 	}
 }
+
+// Flush writes out the log output that is still buffered, before the program exits
+func Flush() {
+	_ = os.Stderr.Sync()
+}
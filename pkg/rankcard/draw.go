@@ -3,18 +3,29 @@ package rankcard
 import (
 	"fmt"
 	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/disintegration/imaging"
-	// "github.com/fogleman/gg"
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
 	"github.com/lucasb-eyer/go-colorful"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
 )
 
+// httpClient downloads the avatar and background images. Cards are rendered while a command
+// waits, so a slow image host must not hold it up.
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
 // SetAvatar sets the user's avatar as the source image.
 // The given source must be a URL to the user's avatar on Discord.
 func (rc *RankCard) SetAvatar(source string) {
-	response, err := http.Get(source)
+	response, err := httpClient.Get(source)
 	if err != nil {
 		return
 	}
@@ -204,3 +215,228 @@ func (rc *RankCard) calculateProgress() int {
 	}
 	return width
 }
+
+// Build draws the rank card and returns it as an image.
+func (rc *RankCard) Build() (image.Image, error) {
+	regular, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse regular font: %w", err)
+	}
+	bold, err := truetype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bold font: %w", err)
+	}
+
+	dc := gg.NewContext(int(rc.Width), int(rc.Height))
+
+	if err := rc.drawBackground(dc); err != nil {
+		return nil, err
+	}
+	rc.drawOverlay(dc)
+	rc.drawAvatar(dc)
+	rc.drawStatus(dc)
+
+	// Username and discriminator
+	dc.SetFontFace(truetype.NewFace(bold, &truetype.Options{Size: 36}))
+	dc.SetColor(hexColor(rc.UserName.Color, color.White))
+	name := ShortenText(rc.UserName.Name, 15)
+	dc.DrawString(name, 275.5, 164)
+	if rc.Discriminator.Discrim != "" && rc.Discriminator.Discrim != "0" {
+		nameWidth, _ := dc.MeasureString(name)
+		dc.SetFontFace(truetype.NewFace(regular, &truetype.Options{Size: 30}))
+		dc.SetColor(hexColor(rc.Discriminator.Color, color.Gray{0x7F}))
+		dc.DrawString("#"+rc.Discriminator.Discrim, 275.5+nameWidth+5, 164)
+	}
+
+	// Required and current XP, right aligned above the progress bar
+	right := rc.ProgressBar.X + rc.ProgressBar.Width
+	dc.SetFontFace(truetype.NewFace(bold, &truetype.Options{Size: 30}))
+	required := " / " + convertNumberToUnits(rc.RequiredXP.Data) + " XP"
+	requiredWidth, _ := dc.MeasureString(required)
+	dc.SetColor(hexColor(rc.RequiredXP.Color, color.Gray{0x7F}))
+	dc.DrawStringAnchored(required, right, 164, 1, 0)
+	dc.SetColor(hexColor(rc.CurrentXP.Color, color.White))
+	dc.DrawStringAnchored(convertNumberToUnits(rc.CurrentXP.Data), right-requiredWidth, 164, 1, 0)
+
+	// Rank and level, right aligned at the top of the card
+	x := right
+	if rc.Level.Display {
+		x = rc.drawStat(dc, regular, bold, x, rc.Level.DisplayText, convertNumberToUnits(rc.Level.Data), rc.Level.TextColor, rc.Level.Color)
+	}
+	if rc.Rank.Display {
+		rc.drawStat(dc, regular, bold, x, rc.Rank.DisplayText, "#"+convertNumberToUnits(rc.Rank.Data), rc.Rank.TextColor, rc.Rank.Color)
+	}
+
+	rc.drawProgressBar(dc)
+
+	return dc.Image(), nil
+}
+
+// Render draws the rank card and writes it to w as a PNG image.
+func (rc *RankCard) Render(w io.Writer) error {
+	img, err := rc.Build()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// drawBackground fills the card with the background color or image. When the image cannot be
+// loaded, e.g. because its URL no longer works, the card falls back to the default color.
+func (rc *RankCard) drawBackground(dc *gg.Context) error {
+	if rc.Background.Type == "image" {
+		img, err := fetchImage(rc.Background.ImageURL)
+		if err == nil {
+			dc.DrawImage(imaging.Fill(img, int(rc.Width), int(rc.Height), imaging.Center, imaging.Lanczos), 0, 0)
+			return nil
+		}
+		log.Printf("Failed to load background image %q, using the default color: %v", rc.Background.ImageURL, err)
+	}
+	dc.SetColor(hexColor(rc.Background.Color, color.RGBA{0x23, 0x27, 0x2A, 0xFF}))
+	dc.DrawRectangle(0, 0, rc.Width, rc.Height)
+	dc.Fill()
+	return nil
+}
+
+// drawOverlay draws the translucent box behind the card content.
+func (rc *RankCard) drawOverlay(dc *gg.Context) {
+	if !rc.Overlay.Display {
+		return
+	}
+	r, g, b, _ := hexColor(rc.Overlay.Color, color.Black).RGBA()
+	dc.SetRGBA(float64(r)/0xFFFF, float64(g)/0xFFFF, float64(b)/0xFFFF, rc.Overlay.Level)
+	dc.DrawRoundedRectangle(20, 36, rc.Width-40, rc.Height-72, 10)
+	dc.Fill()
+}
+
+// drawAvatar draws the avatar clipped to a circle.
+func (rc *RankCard) drawAvatar(dc *gg.Context) {
+	cx := rc.Avatar.X + rc.Avatar.Width/2
+	cy := rc.Avatar.Y + rc.Avatar.Height/2
+	radius := rc.Avatar.Width / 2
+
+	img, ok := rc.Avatar.Source.(image.Image)
+	if !ok {
+		dc.SetColor(color.Gray{0x48})
+		dc.DrawCircle(cx, cy, radius)
+		dc.Fill()
+		return
+	}
+
+	dc.Push()
+	dc.DrawCircle(cx, cy, radius)
+	dc.Clip()
+	dc.DrawImage(imaging.Fill(img, int(rc.Avatar.Width), int(rc.Avatar.Height), imaging.Center, imaging.Lanczos), int(rc.Avatar.X), int(rc.Avatar.Y))
+	dc.ResetClip()
+	dc.Pop()
+}
+
+// drawStatus draws the status as a ring around the avatar or as a dot at its corner.
+func (rc *RankCard) drawStatus(dc *gg.Context) {
+	if rc.Status.Type == "" {
+		return
+	}
+	cx := rc.Avatar.X + rc.Avatar.Width/2
+	cy := rc.Avatar.Y + rc.Avatar.Height/2
+	radius := rc.Avatar.Width / 2
+
+	dc.SetColor(hexColor(rc.Status.Color, color.Gray{0x74}))
+	if rc.Status.Circle {
+		dc.SetLineWidth(rc.Status.Width)
+		dc.DrawCircle(cx, cy, radius+rc.Status.Width/2)
+		dc.Stroke()
+		return
+	}
+
+	// Place the dot on the bottom right edge of the avatar, cut out from the overlay color
+	dotX := cx + radius*0.707
+	dotY := cy + radius*0.707
+	dc.Push()
+	dc.SetColor(hexColor(rc.Overlay.Color, color.Black))
+	dc.DrawCircle(dotX, dotY, 22)
+	dc.Fill()
+	dc.Pop()
+	dc.DrawCircle(dotX, dotY, 16)
+	dc.Fill()
+}
+
+// drawStat draws a label and value (e.g. "RANK #1") ending at x and returns where it starts.
+func (rc *RankCard) drawStat(dc *gg.Context, regular, bold *truetype.Font, x float64, label, valueText, textColor, valueColor string) float64 {
+	dc.SetFontFace(truetype.NewFace(bold, &truetype.Options{Size: 60}))
+	valueWidth, _ := dc.MeasureString(valueText)
+	dc.SetColor(hexColor(valueColor, color.White))
+	dc.DrawStringAnchored(valueText, x, 82, 1, 0)
+
+	dc.SetFontFace(truetype.NewFace(regular, &truetype.Options{Size: 24}))
+	labelWidth, _ := dc.MeasureString(label)
+	dc.SetColor(hexColor(textColor, color.White))
+	dc.DrawStringAnchored(label, x-valueWidth-5, 82, 1, 0)
+
+	return x - valueWidth - labelWidth - 25
+}
+
+// drawProgressBar draws the track and the filled part of the XP progress bar.
+func (rc *RankCard) drawProgressBar(dc *gg.Context) {
+	pb := rc.ProgressBar
+	radius := 0.0
+	if pb.Rounded {
+		radius = pb.Height / 2
+	}
+
+	if pb.Track.Color != nil {
+		dc.SetColor(pb.Track.Color)
+	} else {
+		dc.SetColor(color.RGBA{0x48, 0x4B, 0x4E, 0xFF})
+	}
+	dc.DrawRoundedRectangle(pb.X, pb.Y, pb.Width, pb.Height, radius)
+	dc.Fill()
+
+	width := float64(rc.calculateProgress())
+	if width < pb.Height && pb.Rounded {
+		// Keep the rounded ends from overlapping when there is little progress
+		width = pb.Height
+	}
+
+	switch {
+	case pb.Bar.Type == "gradient" && len(pb.Bar.Grad) > 0:
+		grad := gg.NewLinearGradient(pb.X, pb.Y, pb.X+width, pb.Y)
+		for i, c := range pb.Bar.Grad {
+			stop := 0.0
+			if len(pb.Bar.Grad) > 1 {
+				stop = float64(i) / float64(len(pb.Bar.Grad)-1)
+			}
+			grad.AddColorStop(stop, c)
+		}
+		dc.SetFillStyle(grad)
+	case pb.Bar.Color != nil:
+		dc.SetColor(pb.Bar.Color)
+	default:
+		dc.SetColor(color.White)
+	}
+	dc.DrawRoundedRectangle(pb.X, pb.Y, width, pb.Height, radius)
+	dc.Fill()
+}
+
+// fetchImage downloads and decodes the image at the given URL.
+func fetchImage(source string) (image.Image, error) {
+	response, err := httpClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	img, _, err := image.Decode(response.Body)
+	return img, err
+}
+
+// hexColor parses a hex color, returning the fallback when it is empty or invalid.
+func hexColor(hex string, fallback color.Color) color.Color {
+	c, err := parseHexColor(hex)
+	if err != nil {
+		return fallback
+	}
+	return c
+}
@@ -109,19 +109,68 @@ type RankCard struct {
 // NewRankCard creates a new RankCard instance
 func NewRankCard() *RankCard {
 	return &RankCard{
-		Width:         500,
-		Height:        200,
-		Background:    Background{},
-		ProgressBar:   ProgressBar{},
-		Overlay:       Overlay{},
-		Avatar:        Avatar{},
-		Status:        Status{},
-		Rank:          Rank{},
-		Level:         Level{},
-		CurrentXP:     CurrentXP{},
-		RequiredXP:    RequiredXP{},
-		Discriminator: Discriminator{},
-		UserName:      UserName{},
-		RenderEmojis:  true,
+		Width:  934,
+		Height: 282,
+		Background: Background{
+			Type:  "color",
+			Color: "#23272A",
+		},
+		ProgressBar: ProgressBar{
+			Rounded: true,
+			X:       275.5,
+			Y:       183.75,
+			Height:  37.5,
+			Width:   615,
+			Track: Track{
+				Color: color.RGBA{0x48, 0x4B, 0x4E, 0xFF},
+			},
+			Bar: Bar{
+				Type:  "color",
+				Color: color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+			},
+			Direction: "horizontal",
+		},
+		Overlay: Overlay{
+			Display: true,
+			Level:   0.5,
+			Color:   "#333640",
+		},
+		Avatar: Avatar{
+			X:      70,
+			Y:      50,
+			Height: 180,
+			Width:  180,
+		},
+		Status: Status{
+			Width:  5,
+			Type:   "online",
+			Color:  "#43B581",
+			Circle: false,
+		},
+		Rank: Rank{
+			Display:     true,
+			TextColor:   "#FFFFFF",
+			Color:       "#F3F3F3",
+			DisplayText: "RANK",
+		},
+		Level: Level{
+			Display:     true,
+			TextColor:   "#FFFFFF",
+			Color:       "#F3F3F3",
+			DisplayText: "LEVEL",
+		},
+		CurrentXP: CurrentXP{
+			Color: "#FFFFFF",
+		},
+		RequiredXP: RequiredXP{
+			Color: "#7F8384",
+		},
+		Discriminator: Discriminator{
+			Color: "#7F8384",
+		},
+		UserName: UserName{
+			Color: "#FFFFFF",
+		},
+		RenderEmojis: true,
 	}
 }
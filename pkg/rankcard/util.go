@@ -11,10 +11,7 @@ import (
 func parseColor(c interface{}) (color.Color, error) {
 	switch c := c.(type) {
 	case string:
-		if c[0] == '#' {
-			return parseHexColor(c)
-		}
-		return parseColor(c)
+		return parseHexColor(c)
 	case color.Color:
 		return c, nil
 	default:
@@ -0,0 +1,164 @@
+package trivia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoQuestions is returned when the bank has no question in the requested category
+var ErrNoQuestions = errors.New("no questions in this category")
+
+// Question represents a question of the bank and the answers accepted for it
+type Question struct {
+	Category string   `yaml:"category" json:"category"`
+	Text     string   `yaml:"question" json:"question"`
+	Choices  []string `yaml:"choices" json:"choices"` // shown as buttons, empty for typed answers only
+	Answer   string   `yaml:"answer" json:"answer"`   // must be one of the choices when there are choices
+	Aliases  []string `yaml:"aliases" json:"aliases"` // other typed answers accepted
+}
+
+// Correct reports whether the answer is right, ignoring case and surrounding spaces
+func (q *Question) Correct(answer string) bool {
+	answer = normalize(answer)
+	if answer == normalize(q.Answer) {
+		return true
+	}
+	for _, alias := range q.Aliases {
+		if answer == normalize(alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that the question can be asked
+func (q *Question) validate() error {
+	if strings.TrimSpace(q.Text) == "" {
+		return fmt.Errorf("question has no text")
+	}
+	if strings.TrimSpace(q.Answer) == "" {
+		return fmt.Errorf("question %q has no answer", q.Text)
+	}
+	if len(q.Choices) > 5 {
+		return fmt.Errorf("question %q has more than 5 choices", q.Text)
+	}
+	if len(q.Choices) == 0 {
+		return nil
+	}
+	for _, choice := range q.Choices {
+		if normalize(choice) == normalize(q.Answer) {
+			return nil
+		}
+	}
+	return fmt.Errorf("the answer of question %q is not one of its choices", q.Text)
+}
+
+// Bank represents the questions trivia games are played with
+type Bank struct {
+	questions  []Question
+	categories map[string][]int // question indexes by category
+}
+
+// LoadBank reads the questions from a YAML or JSON file, chosen by its extension
+func LoadBank(path string) (*Bank, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read question bank: %w", err)
+	}
+
+	var questions []Question
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &questions)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &questions)
+	default:
+		return nil, fmt.Errorf("unsupported question bank format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse question bank: %w", err)
+	}
+	return NewBank(questions)
+}
+
+// NewBank creates a bank of the questions, which must all be valid
+func NewBank(questions []Question) (*Bank, error) {
+	bank := &Bank{
+		questions:  questions,
+		categories: make(map[string][]int),
+	}
+	for i := range questions {
+		if err := questions[i].validate(); err != nil {
+			return nil, fmt.Errorf("invalid question %d: %w", i+1, err)
+		}
+		category := normalize(questions[i].Category)
+		questions[i].Category = category
+		bank.categories[category] = append(bank.categories[category], i)
+	}
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("question bank is empty")
+	}
+	return bank, nil
+}
+
+// Len returns the number of questions in the bank
+func (b *Bank) Len() int {
+	return len(b.questions)
+}
+
+// Categories returns the names of the categories, sorted
+func (b *Bank) Categories() []string {
+	names := make([]string, 0, len(b.categories))
+	for category := range b.categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Count returns the number of questions in the category
+func (b *Bank) Count(category string) int {
+	return len(b.categories[normalize(category)])
+}
+
+// Pick returns up to n random questions of the category, or of every category when it is empty.
+// Questions are not repeated, so fewer are returned when the category has less than n.
+func (b *Bank) Pick(category string, n int, rng *rand.Rand) ([]Question, error) {
+	var indexes []int
+	if category == "" {
+		indexes = make([]int, len(b.questions))
+		for i := range indexes {
+			indexes[i] = i
+		}
+	} else {
+		indexes = append(indexes, b.categories[normalize(category)]...)
+	}
+	if len(indexes) == 0 {
+		return nil, ErrNoQuestions
+	}
+
+	rng.Shuffle(len(indexes), func(i, j int) {
+		indexes[i], indexes[j] = indexes[j], indexes[i]
+	})
+	if n > len(indexes) {
+		n = len(indexes)
+	}
+	questions := make([]Question, n)
+	for i := range questions {
+		questions[i] = b.questions[indexes[i]]
+	}
+	return questions, nil
+}
+
+// normalize lowers the case of the text and trims its spaces, for comparisons
+func normalize(text string) string {
+	return strings.ToLower(strings.TrimSpace(text))
+}
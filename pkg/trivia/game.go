@@ -0,0 +1,133 @@
+package trivia
+
+import (
+	"sort"
+	"sync"
+)
+
+// Score represents the score of a player in a game
+type Score struct {
+	UserID   string
+	UserName string
+	Points   int
+	Correct  int // questions answered correctly
+}
+
+// RoundResult represents the outcome of a round
+type RoundResult struct {
+	Question *Question
+	Winners  []Score // fastest correct answers, in order, with the points they won in the round
+}
+
+// Game represents a trivia game of a few rounds, one question per round. Every player answers
+// once per round, and the fastest correct answers score the points of their place.
+type Game struct {
+	mu        sync.Mutex
+	questions []Question
+	points    []int // points for the fastest correct answers of a round, in order
+	round     int   // index of the current question, -1 before the first round
+	open      bool  // whether the current round accepts answers
+
+	scores   map[string]*Score
+	answered map[string]bool // players who answered in the current round
+	correct  []string        // players who answered correctly in the current round, fastest first
+}
+
+// NewGame creates a game asking the questions in order
+func NewGame(questions []Question, points []int) *Game {
+	return &Game{
+		questions: questions,
+		points:    points,
+		round:     -1,
+		scores:    make(map[string]*Score),
+	}
+}
+
+// Rounds returns the number of rounds of the game
+func (g *Game) Rounds() int {
+	return len(g.questions)
+}
+
+// Round returns the number of the current round, from 1, and whether it accepts answers
+func (g *Game) Round() (int, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.round + 1, g.open
+}
+
+// Next starts the next round and returns its number, from 1, and question.
+// It returns false once every round was played.
+func (g *Game) Next() (int, *Question, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.round+1 >= len(g.questions) {
+		return 0, nil, false
+	}
+	g.round++
+	g.open = true
+	g.answered = make(map[string]bool)
+	g.correct = nil
+	return g.round + 1, &g.questions[g.round], true
+}
+
+// Answer records the answer of a player to the question of the round. It returns false when
+// the round is over or the player already answered, in which case the answer is ignored.
+func (g *Game) Answer(round int, userID, userName, answer string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.open || round != g.round+1 || g.answered[userID] {
+		return false
+	}
+	g.answered[userID] = true
+	if _, ok := g.scores[userID]; !ok {
+		g.scores[userID] = &Score{UserID: userID, UserName: userName}
+	}
+	if g.questions[g.round].Correct(answer) {
+		g.correct = append(g.correct, userID)
+	}
+	return true
+}
+
+// EndRound stops accepting answers and scores the fastest correct answers of the round
+func (g *Game) EndRound() RoundResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.open = false
+	result := RoundResult{Question: &g.questions[g.round]}
+	for i, userID := range g.correct {
+		score := g.scores[userID]
+		score.Correct++
+		won := 0
+		if i < len(g.points) {
+			won = g.points[i]
+		}
+		score.Points += won
+		result.Winners = append(result.Winners, Score{UserID: userID, UserName: score.UserName, Points: won, Correct: 1})
+	}
+	return result
+}
+
+// Leaderboard returns the scores of the players who answered, highest first. Ties are broken
+// by the number of correct answers, then by user ID so that the order is stable.
+func (g *Game) Leaderboard() []Score {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	scores := make([]Score, 0, len(g.scores))
+	for _, score := range g.scores {
+		scores = append(scores, *score)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Points != scores[j].Points {
+			return scores[i].Points > scores[j].Points
+		}
+		if scores[i].Correct != scores[j].Correct {
+			return scores[i].Correct > scores[j].Correct
+		}
+		return scores[i].UserID < scores[j].UserID
+	})
+	return scores
+}
@@ -0,0 +1,96 @@
+package wager
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Coin sides a flip can be called on
+const (
+	Heads = "heads"
+	Tails = "tails"
+)
+
+// RNG picks the random numbers bets are resolved with
+type RNG interface {
+	// Intn returns a random number in [0, n)
+	Intn(n int) int
+}
+
+// lockedRand is a seeded RNG that can be used by several goroutines
+type lockedRand struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRNG creates an RNG seeded with the seed, or with the clock when the seed is 0.
+// A fixed seed always resolves the same bets the same way, which is meant for tests.
+func NewRNG(seed int64) RNG {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &lockedRand{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (r *lockedRand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Intn(n)
+}
+
+// FlipResult represents a resolved coin flip
+type FlipResult struct {
+	Side   string
+	Payout int // points paid back, stake included, 0 when lost
+}
+
+// Flip flips a coin for a bet on the side, which pays twice the stake when it is right
+func Flip(rng RNG, stake int, call string) FlipResult {
+	side := Heads
+	if rng.Intn(2) == 1 {
+		side = Tails
+	}
+	result := FlipResult{Side: side}
+	if side == call {
+		result.Payout = 2 * stake
+	}
+	return result
+}
+
+// slotSymbols are the symbols of the slot machine reels
+var slotSymbols = []string{"🍒", "🍋", "🔔", "⭐", "💎", "7️⃣"}
+
+// slotJackpots are the multipliers of the stake paid for three of a symbol
+var slotJackpots = map[string]int{
+	"🍒":   8,
+	"🍋":   8,
+	"🔔":   8,
+	"⭐":   8,
+	"💎":   15,
+	"7️⃣": 30,
+}
+
+// SlotsResult represents a resolved spin of the slot machine
+type SlotsResult struct {
+	Reels  [3]string
+	Payout int // points paid back, stake included, 0 when lost
+}
+
+// Spin spins the three reels. Three of a symbol pays its jackpot and two of a symbol
+// gives the stake back, which keeps the odds with the house.
+func Spin(rng RNG, stake int) SlotsResult {
+	var result SlotsResult
+	for i := range result.Reels {
+		result.Reels[i] = slotSymbols[rng.Intn(len(slotSymbols))]
+	}
+
+	a, b, c := result.Reels[0], result.Reels[1], result.Reels[2]
+	switch {
+	case a == b && b == c:
+		result.Payout = stake * slotJackpots[a]
+	case a == b || b == c || a == c:
+		result.Payout = stake
+	}
+	return result
+}
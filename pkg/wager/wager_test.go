@@ -0,0 +1,76 @@
+package wager
+
+import "testing"
+
+// stubRNG returns its numbers in order, so that tests choose how bets are resolved
+type stubRNG struct {
+	numbers []int
+}
+
+func (r *stubRNG) Intn(n int) int {
+	next := r.numbers[0]
+	r.numbers = r.numbers[1:]
+	return next % n
+}
+
+func TestFlip(t *testing.T) {
+	tests := []struct {
+		name   string
+		roll   int
+		call   string
+		side   string
+		payout int
+	}{
+		{name: "heads called right", roll: 0, call: Heads, side: Heads, payout: 20},
+		{name: "heads called wrong", roll: 0, call: Tails, side: Heads, payout: 0},
+		{name: "tails called right", roll: 1, call: Tails, side: Tails, payout: 20},
+		{name: "tails called wrong", roll: 1, call: Heads, side: Tails, payout: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Flip(&stubRNG{numbers: []int{tt.roll}}, 10, tt.call)
+			if result.Side != tt.side || result.Payout != tt.payout {
+				t.Errorf("Flip() = %+v, want side %s and payout %d", result, tt.side, tt.payout)
+			}
+		})
+	}
+}
+
+func TestSpin(t *testing.T) {
+	tests := []struct {
+		name   string
+		reels  []int // indexes in slotSymbols
+		payout int
+	}{
+		{name: "three cherries", reels: []int{0, 0, 0}, payout: 80},
+		{name: "three stars", reels: []int{3, 3, 3}, payout: 80},
+		{name: "three diamonds", reels: []int{4, 4, 4}, payout: 150},
+		{name: "three sevens", reels: []int{5, 5, 5}, payout: 300},
+		{name: "pair of the first reels", reels: []int{1, 1, 2}, payout: 10},
+		{name: "pair of the last reels", reels: []int{2, 1, 1}, payout: 10},
+		{name: "pair of the outer reels", reels: []int{5, 0, 5}, payout: 10},
+		{name: "no match", reels: []int{0, 1, 2}, payout: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Spin(&stubRNG{numbers: tt.reels}, 10)
+			for i, symbol := range tt.reels {
+				if result.Reels[i] != slotSymbols[symbol] {
+					t.Errorf("reel %d = %s, want %s", i, result.Reels[i], slotSymbols[symbol])
+				}
+			}
+			if result.Payout != tt.payout {
+				t.Errorf("Payout = %d, want %d", result.Payout, tt.payout)
+			}
+		})
+	}
+}
+
+func TestNewRNGSeed(t *testing.T) {
+	a, b := NewRNG(42), NewRNG(42)
+	for i := 0; i < 20; i++ {
+		if x, y := Spin(a, 10), Spin(b, 10); x != y {
+			t.Fatalf("spin %d = %+v and %+v, want the same with the same seed", i, x, y)
+		}
+	}
+}